@@ -4,7 +4,11 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"os"
 
@@ -21,45 +25,61 @@ var (
 	insecure          bool
 	basicAuthUser     string
 	basicAuthPassword string
+	basicAuthPwdFile  string
 	scrapeListen      string
 	scrapeEndpoint    string
+	presetNames       []string
 )
 
 // exportCmd represents the export command
 var exportCmd = &cobra.Command{
-	Use:   "export <metrics-config-file> <endpoint>",
+	Use:   "export <metrics-config-file> [endpoint]",
 	Short: "Exports jolokia metrics from given endpoint, using given metrics mapping config",
-	Long:  ``,
+	Long: `Exports jolokia metrics from given endpoint, using given metrics mapping config.
+
+If no endpoint is given, all targets of the config file are exported. With --replay the
+responses are served from a recording instead, the endpoint defaults to the recorded one.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) < 2 {
+		if len(args) < 1 {
 			cmd.Usage()
 			os.Exit(1)
 		}
 
-		configFile := args[0]
-		config, err := jolokia.LoadConfig(configFile)
-		if err != nil {
-			panic(err)
+		logger, config, source, collectors := setupCollectors(args, nil)
+
+		for _, rwConfig := range config.RemoteWrite {
+			writer, err := jolokia.NewRemoteWriter(logger, rwConfig, source)
+			if err != nil {
+				panic(err)
+			}
+
+			log.Infof("Writing samples to remote endpoint: %v", rwConfig.URL)
+			go writer.Run(nil)
 		}
 
-		endpoint := args[1]
+		for _, otlpConfig := range config.OTLP {
+			writer, err := jolokia.NewOTLPWriter(logger, otlpConfig, source)
+			if err != nil {
+				panic(err)
+			}
 
-		logger := log.Base()
-		if verbose {
-			logger.SetLevel("debug")
-			logger.Debug("Starting in debug level")
-		} else {
-			logger.SetLevel("info")
+			log.Infof("Pushing samples to OpenTelemetry collector: %v", otlpConfig.URL)
+			go writer.Run(nil)
 		}
-		exp, err := jolokia.NewExporter(logger, config, jolokia.Namespace, insecure, endpoint, basicAuthUser, basicAuthPassword)
-		if err != nil {
-			panic(err)
+
+		for _, sinkConfig := range config.Sinks {
+			sink, err := jolokia.NewSink(logger, sinkConfig, source)
+			if err != nil {
+				panic(err)
+			}
+
+			log.Infof("Writing samples to %s sink: %v", sinkConfig.Type, sinkConfig.Address)
+			go sink.Run(nil)
 		}
 
-		prometheus.MustRegister(exp)
+		prometheus.MustRegister(collectors...)
 		prometheus.MustRegister(version.NewCollector("jolokia_exporter"))
 
-		log.Infof("Exporting jolokia endpoint: %v", endpoint)
 		log.Info("Starting jolokia_exporter", version.Info())
 		log.Info("Build context", version.BuildContext())
 		log.Infof("Starting Server: %s", scrapeListen)
@@ -69,13 +89,155 @@ var exportCmd = &cobra.Command{
 	},
 }
 
+// setupCollectors loads the config given as first argument and returns the collectors for
+// the endpoint given as second argument or the targets of the config, together with the
+// source of their samples.
+func setupCollectors(args []string, stop <-chan struct{}) (log.Logger, *jolokia.Config, jolokia.SampleSource, []prometheus.Collector) {
+	logger, config := setup(args[0])
+	endpoints := args[1:]
+
+	var transport http.RoundTripper
+	if recording := loadReplay(); recording != nil {
+		transport = recording
+
+		if len(endpoints) == 0 && len(config.Targets) == 0 {
+			endpoint, err := replayEndpoint(recording)
+			if err != nil {
+				panic(err)
+			}
+			endpoints = []string{endpoint}
+		}
+	}
+
+	source, collectors, err := newCollectors(logger, config, endpoints, transport, stop)
+	if err != nil {
+		panic(err)
+	}
+
+	return logger, config, source, collectors
+}
+
+// setup loads the config file, adds the presets given as flags and configures the logger
+func setup(configFile string) (log.Logger, *jolokia.Config) {
+	config, err := jolokia.LoadConfig(configFile)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := config.AddPresets(presetNames...); err != nil {
+		panic(err)
+	}
+
+	// presets given as flags are added after the config was validated when it was loaded
+	if err := config.Validate(); err != nil {
+		panic(err)
+	}
+
+	logger := log.Base()
+	if verbose {
+		logger.SetLevel("debug")
+		logger.Debug("Starting in debug level")
+	} else {
+		logger.SetLevel("info")
+	}
+
+	if basicAuthPwdFile != "" {
+		b, err := ioutil.ReadFile(basicAuthPwdFile)
+		if err != nil {
+			panic(err)
+		}
+
+		basicAuthPassword = strings.TrimRight(string(b), "\r\n")
+	}
+
+	return logger, config
+}
+
+// endpointTarget returns the target of an endpoint given as argument, configured by the
+// endpoint flags
+func endpointTarget(endpoint string) jolokia.TargetConfig {
+	target := jolokia.TargetConfig{
+		URL: endpoint,
+		TLS: jolokia.TLSConfig{InsecureSkipVerify: insecure},
+	}
+
+	if basicAuthUser != "" || basicAuthPassword != "" {
+		target.BasicAuth = &jolokia.BasicAuth{Username: basicAuthUser, Password: basicAuthPassword}
+	}
+
+	return target
+}
+
+// newCollectors returns an exporter for the endpoint given as argument or, if there is none,
+// for all targets of the config together with the collectors of its service discoveries.
+// The service discoveries run until stop is closed. If transport is not nil, it's used
+// for all jolokia requests.
+func newCollectors(logger log.Logger, config *jolokia.Config, args []string, transport http.RoundTripper, stop <-chan struct{}) (jolokia.SampleSource, []prometheus.Collector, error) {
+	if len(args) > 0 {
+		exp, err := jolokia.NewExporter(jolokia.ClientOptions{
+			Logger:    logger,
+			Config:    config,
+			Namespace: jolokia.Namespace,
+			Target:    endpointTarget(args[0]),
+			Transport: transport,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		log.Infof("Exporting jolokia endpoint: %v", args[0])
+		return exp, []prometheus.Collector{exp}, nil
+	}
+
+	if len(config.Targets) == 0 && len(config.FileSDConfigs) == 0 && len(config.HTTPSDConfigs) == 0 {
+		return nil, nil, errors.New("no endpoint given and config does not contain any targets")
+	}
+
+	targets, err := jolokia.NewTargetsWithTransport(logger, config, jolokia.Namespace, transport)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, exp := range targets.Exporters() {
+		log.Infof("Exporting jolokia endpoint: %v", exp.URI)
+	}
+
+	collectors := []prometheus.Collector{targets}
+
+	for _, sdConfig := range config.FileSDConfigs {
+		log.Infof("Discovering jolokia endpoints from files: %v", sdConfig.Files)
+		go jolokia.NewFileDiscovery(logger, sdConfig, targets).Run(stop)
+	}
+
+	for _, sdConfig := range config.HTTPSDConfigs {
+		discovery, err := jolokia.NewHTTPDiscovery(logger, jolokia.Namespace, sdConfig, targets)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		log.Infof("Discovering jolokia endpoints from: %v", sdConfig.URL)
+		go discovery.Run(stop)
+		collectors = append(collectors, discovery)
+	}
+
+	return targets, collectors, nil
+}
+
+// addEndpointFlags adds the flags configuring the jolokia endpoint to a command
+func addEndpointFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Whether to use verbose https mode")
+	cmd.Flags().BoolVarP(&insecure, "insecure", "i", false, "Whether to use insecure https mode, i.e. skip ssl cert validation (only useful with https endpoint)")
+	cmd.Flags().StringVar(&basicAuthUser, "basic-auth-user", "", "HTTP Basic auth user for authentication on the jolokia endpoint")
+	cmd.Flags().StringVar(&basicAuthPassword, "basic-auth-password", "", "HTTP Basic auth password for authentication on the jolokia endpoint")
+	cmd.Flags().StringVar(&basicAuthPwdFile, "basic-auth-password-file", "", "File to read the HTTP Basic auth password for the jolokia endpoint from, overrides --basic-auth-password")
+	cmd.Flags().StringSliceVar(&presetNames, "preset", nil, fmt.Sprintf("Built-in metric mappings to export in addition to the config, one of %v", jolokia.PresetNames()))
+}
+
 func init() {
 	RootCmd.AddCommand(exportCmd)
 
-	exportCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Whether to use verbose https mode")
-	exportCmd.Flags().BoolVarP(&insecure, "insecure", "i", false, "Whether to use insecure https mode, i.e. skip ssl cert validation (only useful with https endpoint)")
-	exportCmd.Flags().StringVar(&basicAuthUser, "basic-auth-user", "", "HTTP Basic auth user for authentication on the jolokia endpoint")
-	exportCmd.Flags().StringVar(&basicAuthPassword, "basic-auth-password", "", "HTTP Basic auth password for authentication on the jolokia endpoint")
+	addEndpointFlags(exportCmd)
+	addReplayFlag(exportCmd)
 	exportCmd.Flags().StringVarP(&scrapeListen, "listen", "l", ":9422", "Host/Port the exporter should listen listen on")
 	exportCmd.Flags().StringVarP(&scrapeEndpoint, "endpoint", "e", "/metrics", "Path the exporter should listen listen on")
 }
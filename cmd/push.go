@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/common/log"
+	"github.com/scalify/jolokia_exporter/jolokia"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pushGateway          string
+	pushJob              string
+	pushGrouping         []string
+	pushInterval         time.Duration
+	pushDeleteOnShutdown bool
+	pushTimeout          time.Duration
+)
+
+// pushCmd represents the push command
+var pushCmd = &cobra.Command{
+	Use:   "push <metrics-config-file> [endpoint]",
+	Short: "Pushes jolokia metrics from given endpoint to a pushgateway, using given metrics mapping config",
+	Long: `Pushes jolokia metrics from given endpoint to a pushgateway, using given metrics mapping config.
+
+The metrics are collected and pushed in the given interval. On shutdown the metrics are pushed
+a last time and deleted from the pushgateway, unless --delete-on-shutdown=false is given.
+If no endpoint is given, all targets of the config file are pushed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 || pushGateway == "" {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		grouping := make(map[string]string, len(pushGrouping))
+		for _, g := range pushGrouping {
+			parts := strings.SplitN(g, "=", 2)
+			if len(parts) != 2 {
+				log.Fatalf("Invalid grouping %q, expected name=value", g)
+			}
+			grouping[parts[0]] = parts[1]
+		}
+
+		stop := make(chan struct{})
+		logger, _, _, collectors := setupCollectors(args, stop)
+
+		pusher := jolokia.NewPusher(logger, jolokia.PushConfig{
+			URL:              pushGateway,
+			Job:              pushJob,
+			Grouping:         grouping,
+			Interval:         pushInterval,
+			DeleteOnShutdown: pushDeleteOnShutdown,
+			Timeout:          pushTimeout,
+		}, collectors...)
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-signals
+			close(stop)
+		}()
+
+		log.Infof("Pushing to %s every %s", pushGateway, pushInterval)
+		if err := pusher.Run(stop); err != nil {
+			log.Fatalf("Error shutting down pusher: %v", err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(pushCmd)
+
+	addEndpointFlags(pushCmd)
+	pushCmd.Flags().StringVarP(&pushGateway, "gateway", "g", "", "URL of the pushgateway the metrics are pushed to")
+	pushCmd.Flags().StringVar(&pushJob, "job", "jolokia_exporter", "Job name the metrics are pushed with")
+	pushCmd.Flags().StringSliceVar(&pushGrouping, "grouping", nil, "Grouping labels the metrics are pushed with, as name=value")
+	pushCmd.Flags().DurationVar(&pushInterval, "interval", 15*time.Second, "Interval the metrics are pushed in")
+	pushCmd.Flags().DurationVar(&pushTimeout, "timeout", 10*time.Second, "Timeout of every request to the pushgateway")
+	pushCmd.Flags().BoolVar(&pushDeleteOnShutdown, "delete-on-shutdown", true, "Whether to delete the metrics from the pushgateway on shutdown")
+}
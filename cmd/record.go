@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/prometheus/common/log"
+	"github.com/scalify/jolokia_exporter/jolokia"
+	"github.com/spf13/cobra"
+)
+
+var (
+	recordOutput string
+	replayFile   string
+)
+
+// recordCmd represents the record command
+var recordCmd = &cobra.Command{
+	Use:   "record <metrics-config-file> [endpoint]",
+	Short: "Records the jolokia responses of given endpoint to a file, using given metrics mapping config",
+	Long: `Records the jolokia responses of given endpoint to a file, using given metrics mapping config.
+
+The requests for the mappings of the config are sent once and saved together with the raw
+responses. If no endpoint is given, all targets of the config file are recorded. Recordings
+are replayed with the --replay flag of the export and scrape commands, which serve the
+recorded metrics without a live agent, e.g. to reproduce odd metrics in bug reports.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		logger, config := setup(args[0])
+
+		targets := config.Targets
+		if len(args) > 1 {
+			targets = []jolokia.TargetConfig{endpointTarget(args[1])}
+		}
+
+		if len(targets) == 0 {
+			fmt.Fprintln(os.Stderr, "no endpoint given and config does not contain any targets")
+			os.Exit(1)
+		}
+
+		recorder := jolokia.NewRecorder()
+		failed := false
+
+		for _, target := range targets {
+			transport, err := jolokia.NewTransport(target.TLS)
+			if err != nil {
+				panic(err)
+			}
+
+			client, err := jolokia.NewClient(jolokia.ClientOptions{
+				Logger:    logger,
+				Config:    config,
+				Namespace: jolokia.Namespace,
+				Target:    target,
+				Transport: recorder.Transport(transport),
+			})
+			if err != nil {
+				panic(err)
+			}
+
+			log.Infof("Recording jolokia endpoint: %v", target.URL)
+			if _, err := client.Scrape(context.Background()); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", target.URL, err)
+				failed = true
+			}
+		}
+
+		recording := recorder.Recording()
+		if err := recording.Save(recordOutput); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Recorded %d responses to %s\n", len(recording.Exchanges), recordOutput)
+
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// loadReplay loads the recording given by --replay, it returns nil if none is given
+func loadReplay() *jolokia.Recording {
+	if replayFile == "" {
+		return nil
+	}
+
+	recording, err := jolokia.LoadRecording(replayFile)
+	if err != nil {
+		panic(err)
+	}
+
+	log.Infof("Replaying jolokia responses recorded at %s from %s", recording.Time, replayFile)
+	return recording
+}
+
+// replayEndpoint returns the endpoint of a recording to be used if no endpoint is given,
+// that's only possible if all responses were recorded from a single endpoint
+func replayEndpoint(recording *jolokia.Recording) (string, error) {
+	urls := recording.URLs()
+	if len(urls) != 1 {
+		return "", fmt.Errorf("no endpoint given and recording %s contains %d endpoints, expected one", replayFile, len(urls))
+	}
+
+	return urls[0], nil
+}
+
+// addReplayFlag adds the --replay flag to a command
+func addReplayFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&replayFile, "replay", "", "Serve the metrics from a file written by the record command instead of a live jolokia endpoint")
+}
+
+func init() {
+	RootCmd.AddCommand(recordCmd)
+
+	addEndpointFlags(recordCmd)
+	recordCmd.Flags().StringVarP(&recordOutput, "output", "o", "recording.json", "File the recording is written to")
+}
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/scalify/jolokia_exporter/jolokia"
+	"github.com/spf13/cobra"
+)
+
+var scrapeOutput string
+
+// scrapeCmd represents the scrape command
+var scrapeCmd = &cobra.Command{
+	Use:   "scrape <metrics-config-file> [endpoint]",
+	Short: "Scrapes jolokia metrics from given endpoint once and prints them, using given metrics mapping config",
+	Long: `Scrapes jolokia metrics from given endpoint once and prints them, using given metrics mapping config.
+
+The metrics are printed in the prometheus text format, as JSON or as a table showing the
+mbean, attribute and path every metric was read from. Failed mappings are printed to stderr,
+the command exits with a non-zero code if the endpoint couldn't be scraped or any mapping failed.
+With --replay the responses are served from a recording, the endpoint defaults to the recorded one.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 && (len(args) < 1 || replayFile == "") {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		logger, config := setup(args[0])
+
+		var transport http.RoundTripper
+		if recording := loadReplay(); recording != nil {
+			transport = recording
+
+			if len(args) < 2 {
+				endpoint, err := replayEndpoint(recording)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				args = append(args, endpoint)
+			}
+		}
+
+		client, err := jolokia.NewClient(jolokia.ClientOptions{
+			Logger:    logger,
+			Config:    config,
+			Namespace: jolokia.Namespace,
+			Target:    endpointTarget(args[1]),
+			Transport: transport,
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		result, err := client.Scrape(context.Background())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		sort.Slice(result.Samples, func(i, j int) bool {
+			return result.Samples[i].Name < result.Samples[j].Name
+		})
+
+		switch scrapeOutput {
+		case "text":
+			err = printText(result)
+		case "json":
+			err = printJSON(result)
+		case "table":
+			err = printTable(result)
+		default:
+			err = fmt.Errorf("unknown output format %q, expected text, json or table", scrapeOutput)
+		}
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		for _, mappingErr := range result.Errors {
+			fmt.Fprintln(os.Stderr, mappingErr)
+		}
+
+		if len(result.Errors) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// sampleCollector collects a fixed list of samples
+type sampleCollector []jolokia.Sample
+
+func (c sampleCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c sampleCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, sample := range c {
+		ch <- sample.Metric()
+	}
+}
+
+func printText(result *jolokia.ScrapeResult) error {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(sampleCollector(result.Samples)); err != nil {
+		return err
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		return err
+	}
+
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(os.Stdout, family); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type jsonSample struct {
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Type      string            `json:"type"`
+	Value     float64           `json:"value"`
+	Mbean     string            `json:"mbean"`
+	Attribute string            `json:"attribute,omitempty"`
+	Path      string            `json:"path,omitempty"`
+	Mapping   string            `json:"mapping"`
+}
+
+type jsonMappingError struct {
+	Mapping string `json:"mapping"`
+	Mbean   string `json:"mbean"`
+	Status  uint   `json:"status"`
+	Error   string `json:"error"`
+}
+
+func printJSON(result *jolokia.ScrapeResult) error {
+	output := struct {
+		Samples []jsonSample       `json:"samples"`
+		Errors  []jsonMappingError `json:"errors"`
+	}{
+		Samples: make([]jsonSample, 0, len(result.Samples)),
+		Errors:  make([]jsonMappingError, 0, len(result.Errors)),
+	}
+
+	for _, s := range result.Samples {
+		sample := jsonSample{
+			Name:   s.Name,
+			Labels: s.Labels,
+			Type:   valueTypeName(s.Type),
+			Value:  s.Value,
+			Mbean:  s.Mbean,
+		}
+		if s.Mapping != nil {
+			sample.Attribute = s.Mapping.Source.Attribute
+			sample.Path = s.Mapping.Source.Path
+			sample.Mapping = s.Mapping.Target
+		}
+
+		output.Samples = append(output.Samples, sample)
+	}
+
+	for _, e := range result.Errors {
+		output.Errors = append(output.Errors, jsonMappingError{
+			Mapping: e.Mapping.Target,
+			Mbean:   e.Mapping.Source.Mbean,
+			Status:  e.Status,
+			Error:   e.Err.Error(),
+		})
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(output)
+}
+
+func printTable(result *jolokia.ScrapeResult) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVALUE\tTYPE\tMBEAN\tATTRIBUTE\tPATH")
+
+	for _, s := range result.Samples {
+		var attribute, path string
+		if s.Mapping != nil {
+			attribute = s.Mapping.Source.Attribute
+			path = s.Mapping.Source.Path
+		}
+
+		fmt.Fprintf(w, "%s\t%v\t%s\t%s\t%s\t%s\n", s.Name, s.Value, valueTypeName(s.Type), s.Mbean, attribute, path)
+	}
+
+	return w.Flush()
+}
+
+func valueTypeName(t prometheus.ValueType) string {
+	switch t {
+	case prometheus.CounterValue:
+		return jolokia.MetricTypeCounter
+	case prometheus.GaugeValue:
+		return jolokia.MetricTypeGauge
+	default:
+		return "untyped"
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(scrapeCmd)
+
+	addEndpointFlags(scrapeCmd)
+	addReplayFlag(scrapeCmd)
+	scrapeCmd.Flags().StringVarP(&scrapeOutput, "output", "o", "text", "Output format, one of text, json or table")
+}
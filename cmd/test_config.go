@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/scalify/jolokia_exporter/jolokia"
+	"github.com/spf13/cobra"
+)
+
+// testConfigCmd represents the test-config command
+var testConfigCmd = &cobra.Command{
+	Use:   "test-config <metrics-config-file> <response-file> <expected-metrics-file>",
+	Short: "Tests a metrics mapping config against a recorded jolokia response and the expected metrics",
+	Long: `Tests a metrics mapping config against a recorded jolokia response and the expected metrics.
+
+The mappings of the config are applied to the response offline, like the exporter does for a
+live endpoint, and the resulting series are compared to the expected metrics file in the
+prometheus text format. Missing, extra and changed series are printed and make the command
+exit with a non-zero code, as do mappings that fail on the response.
+
+The response file holds a jolokia response to the requests of the config, e.g. the response
+of an exchange written by the record command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 3 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		logger, config := setup(args[0])
+
+		client, err := jolokia.NewClient(jolokia.ClientOptions{
+			Logger:    logger,
+			Config:    config,
+			Namespace: jolokia.Namespace,
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		response, err := ioutil.ReadFile(args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		result, err := client.ScrapeResponse(response)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", args[1], err)
+			os.Exit(1)
+		}
+
+		f, err := os.Open(args[2])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+
+		expected, err := jolokia.ReadSeries(f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", args[2], err)
+			os.Exit(1)
+		}
+
+		diff := jolokia.DiffSeries(expected, jolokia.SampleSeries(result.Samples))
+
+		for _, s := range diff.Missing {
+			fmt.Printf("- %s\n", s)
+		}
+		for _, s := range diff.Extra {
+			fmt.Printf("+ %s\n", s)
+		}
+		for _, s := range diff.Changed {
+			fmt.Printf("~ %s\n", s)
+		}
+		for _, mappingErr := range result.Errors {
+			fmt.Printf("! %s\n", mappingErr)
+		}
+
+		if !diff.Empty() || len(result.Errors) > 0 {
+			fmt.Printf("FAILED: %d missing, %d extra, %d changed series, %d failed mappings\n",
+				len(diff.Missing), len(diff.Extra), len(diff.Changed), len(result.Errors))
+			os.Exit(1)
+		}
+
+		fmt.Printf("SUCCESS: %d series match %s\n", len(expected), args[2])
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(testConfigCmd)
+
+	testConfigCmd.Flags().StringSliceVar(&presetNames, "preset", nil, fmt.Sprintf("Built-in metric mappings to test in addition to the config, one of %v", jolokia.PresetNames()))
+}
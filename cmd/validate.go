@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/scalify/jolokia_exporter/jolokia"
+	"github.com/spf13/cobra"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate <metrics-config-file>",
+	Short: "Validates a metrics mapping config",
+	Long: `Validates a metrics mapping config.
+
+Unknown settings, invalid metric and label names, malformed mbean names and paths, duplicate
+targets and references to unknown modules are reported with their line in the config file.
+The command exits with a non-zero code if the config is invalid.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		config, err := jolokia.LoadConfig(args[0])
+		if err == nil {
+			err = config.AddPresets(presetNames...)
+		}
+		if err == nil {
+			err = config.Validate()
+		}
+
+		if errs, ok := err.(jolokia.ValidationErrors); ok {
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], e)
+			}
+			os.Exit(1)
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("%s is valid\n", args[0])
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(validateCmd)
+
+	validateCmd.Flags().StringSliceVar(&presetNames, "preset", nil, fmt.Sprintf("Built-in metric mappings to validate in addition to the config, one of %v", jolokia.PresetNames()))
+}
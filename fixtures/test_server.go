@@ -1,27 +1,33 @@
 package main
 
 import (
-	"fmt"
 	"log"
 	"net/http"
+	"runtime"
+
+	"github.com/scalify/jolokia_exporter/jolokia/jolokiatest"
 )
 
+const basePath = "/manage/jolokia"
+
 func main() {
-	http.HandleFunc("/manage/jolokia", metrics)
-	log.Fatal(http.ListenAndServe(":3000", nil))
-}
+	registry, err := jolokiatest.LoadRegistry("mbeans.json")
+	if err != nil {
+		log.Fatal(err)
+	}
 
-func metrics(w http.ResponseWriter, r *http.Request) {
-	if u, p, ok := r.BasicAuth(); !ok {
-		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprint(w, "Unauthorized")
-		return
-	} else if u != "admin" || p != "secret" {
-		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprint(w, "Wrong credentials")
-		return
+	if err := registry.AddOperation("java.lang:type=Memory", "gc", func(args []interface{}) (interface{}, error) {
+		runtime.GC()
+		return nil, nil
+	}); err != nil {
+		log.Fatal(err)
 	}
 
-	w.Header().Add("Content-Type", "application/json")
-	http.ServeFile(w, r, "metrics.json")
+	agent := jolokiatest.NewAgent(registry)
+	agent.Auth = jolokiatest.BasicAuth("admin", "secret")
+	agent.BasePath = basePath
+
+	http.Handle(basePath, agent)
+	http.Handle(basePath+"/", agent)
+	log.Fatal(http.ListenAndServe(":3000", nil))
 }
@@ -0,0 +1,604 @@
+package jolokia
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// ClientOptions configures a Client or an Exporter
+type ClientOptions struct {
+	// Logger defaults to the base logger
+	Logger log.Logger
+	// Config holds the metric mappings, the mappings of the module of the target are used
+	Config *Config
+	// Namespace is prepended to all sample names
+	Namespace string
+	// Target is the jolokia endpoint with its credentials and tls settings
+	Target TargetConfig
+	// Labels are added to all samples
+	Labels map[string]string
+	// Transport is used for the requests instead of a transport with the tls settings of
+	// the target, e.g. to record or replay responses
+	Transport http.RoundTripper
+}
+
+// Client requests the metrics of a jolokia endpoint and flattens them into samples. It
+// can be used on its own or through an Exporter, which exports the samples for prometheus.
+type Client struct {
+	logger            log.Logger
+	namespace         string
+	URI               string
+	labels            map[string]string
+	basicAuthUser     string
+	basicAuthPassword string
+
+	client            *http.Client
+	requestBody       []byte
+	requests          []*readRequest
+	collisionStrategy string
+	maxResponseSize   int64
+	maxSeries         int
+	names             *nameCache
+	scrapeTimeout     time.Duration
+	retry             retryPolicy
+	breaker           *circuitBreaker
+	stats             *clientStats
+
+	// cacheMutex guards the cached samples of the requests and whether the endpoint was
+	// reached by the last request
+	cacheMutex sync.Mutex
+	reached    bool
+}
+
+// A ScrapeResult holds the samples of a scrape. Mappings that could not be resolved are
+// reported as MappingErrors, they don't fail the whole scrape.
+type ScrapeResult struct {
+	Samples []Sample
+	Errors  []MappingError
+	// Collisions lists the samples whose names were already used by other samples, they
+	// are resolved with the collision strategy of the config
+	Collisions []NameCollision
+	Duration   time.Duration
+	// Reached tells whether the endpoint responded at all
+	Reached bool
+	// Retries is the number of requests that were retried
+	Retries int
+}
+
+// A MappingError is returned for every mapping whose value could not be read or flattened
+type MappingError struct {
+	Mapping MetricMapping
+	// Status is the status of the jolokia response for the mapping
+	Status uint
+	Err    error
+}
+
+func (e MappingError) Error() string {
+	return fmt.Sprintf("unable to get metric %s: %v", e.Mapping.Target, e.Err)
+}
+
+// NewClient returns an initialized Client
+func NewClient(options ClientOptions) (*Client, error) {
+	if options.Logger == nil {
+		options.Logger = log.Base()
+	}
+
+	client := &http.Client{Transport: options.Transport}
+	if options.Transport == nil {
+		var err error
+		if client, err = newHTTPClient(options.Target.TLS); err != nil {
+			return nil, err
+		}
+	}
+
+	metrics, err := options.Config.ModuleMetrics(options.Target.Module)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		logger:            options.Logger,
+		namespace:         options.Namespace,
+		URI:               options.Target.URL,
+		labels:            options.Labels,
+		client:            client,
+		collisionStrategy: options.Config.CollisionStrategy,
+		maxResponseSize:   options.Config.MaxResponseSize,
+		maxSeries:         options.Config.MaxSeries,
+		names:             newNameCache(options.Namespace, options.Labels),
+		scrapeTimeout:     time.Duration(options.Config.ScrapeTimeout),
+		retry:             newRetryPolicy(options.Config.Retry),
+		breaker:           newCircuitBreaker(options.Config.CircuitBreaker),
+		stats:             newClientStats(options.Namespace, options.Labels),
+	}
+
+	c.basicAuthUser, c.basicAuthPassword, err = options.Target.BasicAuth.credentials()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read password file of target %s: %v", targetName(options.Target), err)
+	}
+
+	if c.scrapeTimeout <= 0 {
+		c.scrapeTimeout = defaultScrapeTimeout
+	}
+
+	if err := c.prepare(metrics); err != nil {
+		return nil, err
+	}
+
+	c.logger.Debugf("Prepared jolokia request: %s", c.requestBody)
+
+	return c, nil
+}
+
+// Scrape requests the metrics from the jolokia endpoint. If the endpoint can't be reached
+// or its response can't be read, an error is returned together with a result telling
+// whether the endpoint was reached and how long the request took. Mappings with an
+// interval are only requested once it passed, their cached samples are returned in between.
+// If all mappings are cached, the endpoint isn't requested at all and the result tells
+// whether it was reached last time. While the circuit breaker is open, the scrape fails
+// without requesting the endpoint. The cached samples of the mappings that aren't due are
+// returned even if the scrape fails.
+func (c *Client) Scrape(ctx context.Context) (*ScrapeResult, error) {
+	result := newScrapeResult()
+
+	due := c.dueRequests(time.Now())
+	if len(due) == 0 {
+		c.cacheMutex.Lock()
+		result.Reached = c.reached
+		c.cacheMutex.Unlock()
+
+		c.addSamples(result, nil, nil, time.Now())
+		return result, nil
+	}
+
+	allowed, probe := c.breaker.allow(time.Now())
+	if !allowed {
+		c.addCachedSamples(result, due)
+		return result, c.breaker.openError()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.scrapeTimeout)
+	defer cancel()
+
+	// a probe of the circuit breaker isn't retried
+	retries := c.retry.maxRetries
+	if probe {
+		retries = 0
+	}
+
+	err := c.scrape(ctx, due, retries, result)
+	c.breaker.record(err == nil, time.Now())
+	if err != nil {
+		c.addCachedSamples(result, due)
+	}
+
+	return result, err
+}
+
+// addCachedSamples adds the cached samples of the requests that aren't due to the result
+// of a failed scrape, the due requests are left out as if they failed
+func (c *Client) addCachedSamples(result *ScrapeResult, due []*readRequest) {
+	fresh := make(map[*readRequest][]Sample, len(due))
+	failed := make(map[*readRequest]bool, len(due))
+	for _, r := range due {
+		fresh[r] = nil
+		failed[r] = true
+	}
+
+	c.addSamples(result, fresh, failed, time.Now())
+}
+
+// scrape requests the due requests and adds their samples to the result
+func (c *Client) scrape(ctx context.Context, due []*readRequest, retries int, result *ScrapeResult) error {
+	requestBody := c.requestBody
+	if len(due) < len(c.requests) {
+		metrics := make(Request, 0, len(due))
+		for _, r := range due {
+			metrics = append(metrics, r.metric)
+		}
+
+		var err error
+		if requestBody, err = json.Marshal(metrics); err != nil {
+			return err
+		}
+	}
+
+	startTime := time.Now()
+
+	resp, err := c.send(ctx, requestBody, retries, result)
+	result.Duration = time.Since(startTime)
+	c.stats.phases.WithLabelValues(phaseHTTP).Observe(result.Duration.Seconds())
+
+	c.cacheMutex.Lock()
+	c.reached = err == nil
+	c.cacheMutex.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("error scraping jolokia endpoint: %v", err)
+	}
+	result.Reached = true
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("there was an error, response code is %d, expected 200", resp.StatusCode)
+	}
+
+	var body io.Reader = resp.Body
+	if c.maxResponseSize > 0 {
+		body = &limitedReader{r: resp.Body, max: c.maxResponseSize}
+	}
+
+	return c.flatten(body, result, due)
+}
+
+// send posts the request body to the endpoint. Transport errors and responses with a
+// retryable status are retried with backoff, as long as retries are left and the backoff
+// ends before the deadline of the context. The last response or error is returned.
+func (c *Client) send(ctx context.Context, body []byte, retries int, result *ScrapeResult) (*http.Response, error) {
+	for retry := 1; ; retry++ {
+		req, err := http.NewRequest(http.MethodPost, c.URI, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		req = req.WithContext(ctx)
+		req.SetBasicAuth(c.basicAuthUser, c.basicAuthPassword)
+
+		resp, err := c.client.Do(req)
+		if retry > retries || (err == nil && !retryableStatus(resp.StatusCode)) || ctx.Err() != nil {
+			return resp, err
+		}
+
+		delay := c.retry.backoff(retry)
+		if exceedsDeadline(ctx, delay) {
+			return resp, err
+		}
+
+		if err == nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxDiscardedBody))
+			resp.Body.Close()
+			err = fmt.Errorf("response code is %d", resp.StatusCode)
+		}
+
+		c.logger.Debugf("Retrying request to %s in %s: %v", c.URI, delay, err)
+		if !sleep(ctx, delay) {
+			return nil, err
+		}
+		result.Retries++
+	}
+}
+
+// dueRequests returns the requests to send, in the order of the request body
+func (c *Client) dueRequests(now time.Time) []*readRequest {
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+
+	due := make([]*readRequest, 0, len(c.requests))
+	for _, r := range c.requests {
+		if r.due(now) {
+			due = append(due, r)
+		}
+	}
+
+	return due
+}
+
+// ScrapeResponse flattens a response to the requests of the client that was recorded
+// before, as if it was returned by the endpoint. It allows to test metric mappings offline.
+func (c *Client) ScrapeResponse(body []byte) (*ScrapeResult, error) {
+	result := newScrapeResult()
+	result.Reached = true
+
+	return result, c.flatten(bytes.NewReader(body), result, c.requests)
+}
+
+func newScrapeResult() *ScrapeResult {
+	return &ScrapeResult{
+		Samples:    make([]Sample, 0),
+		Errors:     make([]MappingError, 0),
+		Collisions: make([]NameCollision, 0),
+	}
+}
+
+// flatten adds the samples and mapping errors of a jolokia response to the given requests
+// to the result, together with the cached samples of the other requests
+func (c *Client) flatten(body io.Reader, result *ScrapeResult, requests []*readRequest) error {
+	counter := &countingReader{r: body}
+	startTime := time.Now()
+
+	response, err := decodeResponse(counter)
+	c.stats.phases.WithLabelValues(phaseDecode).Observe(time.Since(startTime).Seconds())
+	c.stats.responseSize.Observe(float64(counter.n))
+
+	if _, ok := err.(errResponseTooLarge); ok {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("error unmarshalling json data: %v", err)
+	}
+
+	c.logger.Debugf("Result has %d rows", len(response))
+	startTime = time.Now()
+
+	// the responses are matched to the requests by their request, different requests may
+	// only look the same if they are of different intervals, they are answered in order
+	pending := make(map[string][]*readRequest, len(requests))
+	for _, r := range requests {
+		pending[r.metric.String()] = append(pending[r.metric.String()], r)
+	}
+
+	fresh := make(map[*readRequest][]Sample, len(requests))
+	failed := make(map[*readRequest]bool)
+	nonNumeric, nulls := 0, 0
+	for _, metric := range response {
+		nonNumeric += metric.nonNumeric
+		nulls += metric.nulls
+
+		queue := pending[metric.request.String()]
+		if len(queue) == 0 {
+			log.Errorf("Unable to find mapping for key %s", metric.request.String())
+			c.stats.lookupMisses.Inc()
+			continue
+		}
+		request := queue[0]
+		pending[metric.request.String()] = queue[1:]
+
+		errors := len(result.Errors)
+		samples := make([]Sample, 0)
+
+		pattern := isMbeanPattern(request.metric.Mbean)
+		for _, rm := range request.mappings {
+			samples = c.mappingSamples(samples, result, metric, rm, pattern)
+		}
+
+		fresh[request] = samples
+		failed[request] = len(result.Errors) > errors
+	}
+
+	c.addSamples(result, fresh, failed, time.Now())
+
+	c.stats.dropped.WithLabelValues(dropNonNumeric).Add(float64(nonNumeric))
+	c.stats.dropped.WithLabelValues(dropNull).Add(float64(nulls))
+	c.stats.phases.WithLabelValues(phaseFlatten).Observe(time.Since(startTime).Seconds())
+
+	return nil
+}
+
+// addSamples adds the samples of the requests to the result in the order of the requests,
+// the fresh ones of the requests that were answered and the cached ones of the others.
+// The fresh samples of requests with an interval are cached unless a mapping of the
+// request failed, so it's requested again by the next scrape. Then name collisions of all
+// samples are resolved and the series over the series limits are dropped.
+func (c *Client) addSamples(result *ScrapeResult, fresh map[*readRequest][]Sample, failed map[*readRequest]bool, now time.Time) {
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+
+	for _, r := range c.requests {
+		samples, ok := fresh[r]
+		if ok && r.interval > 0 && !failed[r] {
+			r.scraped = now
+			r.samples = samples
+		} else if !ok && r.interval > 0 && !r.scraped.IsZero() {
+			samples = r.samples
+		}
+
+		result.Samples = append(result.Samples, samples...)
+	}
+
+	result.Samples, result.Collisions = resolveCollisions(result.Samples, c.collisionStrategy)
+
+	var dropped map[string]int
+	result.Samples, dropped = limitSeries(result.Samples, c.maxSeries)
+	if len(dropped) > 0 {
+		c.logger.Warnf("Dropped series over the series limits of %s: %s", c.URI, droppedSeriesMessage(dropped))
+	}
+	for target, count := range dropped {
+		c.stats.seriesDropped.WithLabelValues(target).Add(float64(count))
+	}
+
+	c.stats.observeSamples(result.Samples)
+}
+
+// mappingSamples appends the samples of a mapping within the response to its request to
+// the given samples, errors are added to the result
+func (c *Client) mappingSamples(samples []Sample, result *ScrapeResult, metric responseEntry, rm requestMapping, pattern bool) []Sample {
+	mapping := rm.mapping
+
+	if metric.status != 200 {
+		result.Errors = append(result.Errors, MappingError{
+			Mapping: mapping,
+			Status:  metric.status,
+			Err:     fmt.Errorf("%s %v %v", metric.request.String(), metric.errorType, metric.error),
+		})
+		return samples
+	}
+
+	if metric.valueErr != nil {
+		result.Errors = append(result.Errors, MappingError{
+			Mapping: mapping,
+			Status:  metric.status,
+			Err:     fmt.Errorf("failed to handle value of %s as understandable value: %v", metric.request.String(), metric.valueErr),
+		})
+		return samples
+	}
+
+	if message, ok := rm.attributeError(metric.errors, pattern); ok {
+		result.Errors = append(result.Errors, MappingError{
+			Mapping: mapping,
+			Status:  metric.status,
+			Err:     fmt.Errorf("%s %s", metric.request.String(), message),
+		})
+		return samples
+	}
+
+	valueType, _ := mapping.valueType()
+	values := rm.filterValues(rm.values(metric.values, pattern), pattern)
+	if rm.templates != nil {
+		return c.templateSamples(samples, result, values, rm, pattern, valueType)
+	}
+
+	for _, v := range c.names.flatValues(mapping, values) {
+		c.logger.Debugf("Adding key %s with value %v", v.name, v.value)
+
+		sample := c.newSample(v.fqName, v.name, valueType, v.value)
+		sample.setDesc(v.desc)
+		sample.Mbean = v.mbean
+		sample.Mapping = &mapping
+		samples = append(samples, sample)
+	}
+
+	return samples
+}
+
+// templateSamples appends the samples of values of a mapping with templates. With a target
+// template the values are named by rendering it, otherwise like any flattened value.
+func (c *Client) templateSamples(samples []Sample, result *ScrapeResult, values []keyedValue, rm requestMapping, pattern bool, valueType prometheus.ValueType) []Sample {
+	mapping := rm.mapping
+
+	var flat []flatValue
+	if rm.templates.target == nil {
+		flat = c.names.flatValues(mapping, values)
+	}
+
+	for i, v := range values {
+		mbean := mapping.Source.Mbean
+		if pattern && len(v.keys) > 0 {
+			mbean = v.keys[0]
+		}
+		tv := rm.templateValue(v, mbean, pattern)
+
+		var name, help string
+		if flat != nil {
+			name, help = flat[i].fqName, flat[i].name
+		} else {
+			help = rm.templates.target.renderName(tv)
+			name = prometheus.BuildFQName(c.namespace, "", help)
+
+			if !metricNameRegExp.MatchString(name) {
+				result.Errors = append(result.Errors, MappingError{
+					Mapping: mapping,
+					Status:  200,
+					Err:     fmt.Errorf("target %s renders invalid metric name %q for value %v of %s", mapping.Target, name, v.keys, mbean),
+				})
+				continue
+			}
+		}
+
+		sample := c.newSample(name, help, valueType, v.value)
+		sample.Labels = make(map[string]string, len(c.labels)+len(rm.templates.labels))
+		for label, value := range c.labels {
+			sample.Labels[label] = value
+		}
+		for label, t := range rm.templates.labels {
+			sample.Labels[label] = t.renderLabel(tv)
+		}
+		sample.Mbean = mbean
+		sample.Mapping = &mapping
+		samples = append(samples, sample)
+	}
+
+	return samples
+}
+
+func (c *Client) newSample(name, help string, valueType prometheus.ValueType, value float64) Sample {
+	return Sample{
+		Name:         name,
+		Help:         help,
+		Labels:       c.labels,
+		TargetLabels: c.labels,
+		Endpoint:     c.URI,
+		Type:         valueType,
+		Value:        value,
+		Timestamp:    time.Now(),
+	}
+}
+
+func (c *Client) prepare(metrics []MetricMapping) error {
+	req := Request{}
+
+	for _, m := range metrics {
+		if _, err := m.valueType(); err != nil {
+			return err
+		}
+	}
+
+	c.requests = groupRequests(metrics)
+	for _, r := range c.requests {
+		for i, rm := range r.mappings {
+			c.logger.Debugf("Adding mapping for %q to %q", r.metric.String(), rm.mapping.Target)
+
+			filter, err := newKeyFilter(rm.mapping)
+			if err != nil {
+				return err
+			}
+			r.mappings[i].filter = filter
+
+			if r.mappings[i].templates, err = newMappingTemplates(rm.mapping); err != nil {
+				return err
+			}
+		}
+		req = append(req, r.metric)
+	}
+
+	var err error
+	c.requestBody, err = json.Marshal(req)
+	return err
+}
+
+// valueType returns the prometheus value type of the metrics of the mapping
+func (m MetricMapping) valueType() (prometheus.ValueType, error) {
+	switch m.Type {
+	case "":
+		return prometheus.UntypedValue, nil
+	case MetricTypeGauge:
+		return prometheus.GaugeValue, nil
+	case MetricTypeCounter:
+		return prometheus.CounterValue, nil
+	default:
+		return prometheus.UntypedValue, fmt.Errorf("unknown type %q of metric %s, expected %s or %s", m.Type, m.Target, MetricTypeGauge, MetricTypeCounter)
+	}
+}
+
+type errResponseTooLarge struct {
+	max int64
+}
+
+func (e errResponseTooLarge) Error() string {
+	return fmt.Sprintf("response exceeds the maximum size of %d bytes", e.max)
+}
+
+// limitedReader fails once more than max bytes are read, so oversized responses are
+// rejected without reading them completely
+type limitedReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.read > l.max {
+		return 0, errResponseTooLarge{l.max}
+	}
+
+	if remaining := l.max + 1 - l.read; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.max {
+		return n, errResponseTooLarge{l.max}
+	}
+
+	return n, err
+}
@@ -0,0 +1,279 @@
+package jolokia
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const scrapeResponse = `[
+  {
+    "request": {"mbean": "java.lang:type=Threading", "attribute": "ThreadCount", "type": "read"},
+    "value": 421,
+    "status": 200
+  },
+  {
+    "request": {"mbean": "java.lang:name=*,type=GarbageCollector", "attribute": "CollectionCount", "type": "read"},
+    "value": {
+      "java.lang:name=G1 Old Generation,type=GarbageCollector": {"CollectionCount": 0},
+      "java.lang:name=G1 Young Generation,type=GarbageCollector": {"CollectionCount": 12}
+    },
+    "status": 200
+  },
+  {
+    "request": {"mbean": "java.lang:type=Missing", "attribute": "Value", "type": "read"},
+    "error": "javax.management.InstanceNotFoundException : java.lang:type=Missing",
+    "error_type": "javax.management.InstanceNotFoundException",
+    "status": 404
+  }
+]`
+
+func TestClient_Scrape(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, scrapeResponse)
+	}))
+	defer agent.Close()
+
+	config := &Config{
+		Metrics: []MetricMapping{
+			{
+				Source: MetricSource{Mbean: "java.lang:type=Threading", Attribute: "ThreadCount"},
+				Target: "java_threading_thread_count",
+				Type:   MetricTypeGauge,
+			},
+			{
+				Source: MetricSource{Mbean: "java.lang:name=*,type=GarbageCollector", Attribute: "CollectionCount"},
+				Target: "java_gc",
+				Type:   MetricTypeCounter,
+			},
+			{
+				Source: MetricSource{Mbean: "java.lang:type=Missing", Attribute: "Value"},
+				Target: "java_missing",
+			},
+		},
+	}
+
+	client, err := NewClient(ClientOptions{
+		Config:    config,
+		Namespace: Namespace,
+		Target:    TargetConfig{URL: agent.URL},
+		Labels:    map[string]string{"env": "test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.Scrape(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Reached {
+		t.Error("Expected endpoint to be reached")
+	}
+
+	sort.Slice(result.Samples, func(i, j int) bool {
+		return result.Samples[i].Name < result.Samples[j].Name
+	})
+
+	expected := []struct {
+		name      string
+		mbean     string
+		target    string
+		valueType prometheus.ValueType
+		value     float64
+	}{
+		{"jolokia_java_gc_java_lang_name_g_1_old_generation_type_garbage_collector_collection_count", "java.lang:name=G1 Old Generation,type=GarbageCollector", "java_gc", prometheus.CounterValue, 0},
+		{"jolokia_java_gc_java_lang_name_g_1_young_generation_type_garbage_collector_collection_count", "java.lang:name=G1 Young Generation,type=GarbageCollector", "java_gc", prometheus.CounterValue, 12},
+		{"jolokia_java_threading_thread_count", "java.lang:type=Threading", "java_threading_thread_count", prometheus.GaugeValue, 421},
+	}
+
+	if len(result.Samples) != len(expected) {
+		t.Fatalf("Expected %d samples, got %+v", len(expected), result.Samples)
+	}
+
+	for i, e := range expected {
+		s := result.Samples[i]
+		if s.Name != e.name || s.Mbean != e.mbean || s.Type != e.valueType || s.Value != e.value {
+			t.Errorf("Expected sample %+v, got %+v", e, s)
+		}
+		if s.Mapping == nil || s.Mapping.Target != e.target {
+			t.Errorf("Expected sample %s to refer to mapping %s, got %+v", s.Name, e.target, s.Mapping)
+		}
+		if s.Labels["env"] != "test" || s.Endpoint != agent.URL {
+			t.Errorf("Expected sample %s to carry labels and endpoint, got %+v", s.Name, s)
+		}
+	}
+
+	if len(result.Errors) != 1 || result.Errors[0].Mapping.Target != "java_missing" || result.Errors[0].Status != 404 {
+		t.Errorf("Expected a single mapping error for java_missing, got %+v", result.Errors)
+	}
+}
+
+func TestClient_ScrapeUnreachable(t *testing.T) {
+	client, err := NewClient(ClientOptions{
+		Config:    expectedConfig,
+		Namespace: Namespace,
+		Target:    TargetConfig{URL: "http://127.0.0.1:1/jolokia"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.Scrape(context.Background())
+	if err == nil {
+		t.Fatal("Expected an error for an unreachable endpoint")
+	}
+
+	if result.Reached || len(result.Samples) != 0 {
+		t.Errorf("Expected an empty result of an unreachable endpoint, got %+v", result)
+	}
+}
+
+func TestClient_ScrapeInterval(t *testing.T) {
+	agent := newTestAgent(nil)
+
+	bodies := make([]string, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		agent.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	config := &Config{
+		Metrics: []MetricMapping{
+			{Source: MetricSource{Mbean: "java.lang:type=Threading", Attribute: "ThreadCount"}, Target: "threads"},
+			{Source: MetricSource{Mbean: "java.lang:type=Threading", Attribute: "PeakThreadCount"}, Target: "threads_peak", Interval: Duration(time.Hour)},
+		},
+	}
+
+	client, err := NewClient(ClientOptions{Config: config, Namespace: Namespace, Target: TargetConfig{URL: srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scrape := func(threads, peak float64) []Sample {
+		result, err := client.Scrape(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		values := map[string]float64{"jolokia_threads": threads, "jolokia_threads_peak": peak}
+		if len(result.Samples) != len(values) {
+			t.Fatalf("Expected %d samples, got %+v", len(values), result.Samples)
+		}
+		for _, s := range result.Samples {
+			if s.Value != values[s.Name] {
+				t.Errorf("Expected %s to be %v, got %v", s.Name, values[s.Name], s.Value)
+			}
+		}
+
+		return result.Samples
+	}
+
+	first := scrape(421, 437)
+
+	agent.Registry.SetAttribute("java.lang:type=Threading", "ThreadCount", 422)
+	agent.Registry.SetAttribute("java.lang:type=Threading", "PeakThreadCount", 438)
+
+	second := scrape(422, 437)
+	if strings.Contains(bodies[1], "PeakThreadCount") {
+		t.Errorf("Expected a cached mapping not to be requested, got %s", bodies[1])
+	}
+	if !second[1].Timestamp.Equal(first[1].Timestamp) {
+		t.Error("Expected a cached sample to keep its timestamp")
+	}
+
+	// the interval passed
+	client.requests[1].scraped = time.Now().Add(-time.Hour)
+	scrape(422, 438)
+	if !strings.Contains(bodies[2], "PeakThreadCount") {
+		t.Errorf("Expected a mapping to be requested once its interval passed, got %s", bodies[2])
+	}
+}
+
+func TestClient_ScrapeCachedOnFailure(t *testing.T) {
+	agent := newTestAgent(nil)
+	srv := httptest.NewServer(agent)
+	defer srv.Close()
+
+	config := &Config{
+		Metrics: []MetricMapping{
+			{Source: MetricSource{Mbean: "java.lang:type=Threading", Attribute: "ThreadCount"}, Target: "threads"},
+			{Source: MetricSource{Mbean: "java.lang:type=Threading", Attribute: "PeakThreadCount"}, Target: "threads_peak", Interval: Duration(time.Hour)},
+		},
+		CircuitBreaker: CircuitBreakerConfig{FailureThreshold: 1, ProbeInterval: Duration(time.Hour)},
+	}
+
+	client, err := NewClient(ClientOptions{Config: config, Namespace: Namespace, Target: TargetConfig{URL: srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Scrape(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	agent.FailRequests(-1, http.StatusServiceUnavailable)
+
+	// the first failure opens the breaker, the second scrape isn't sent
+	for i := 0; i < 2; i++ {
+		result, err := client.Scrape(context.Background())
+		if err == nil {
+			t.Fatal("Expected the scrape to fail")
+		}
+
+		if len(result.Samples) != 1 || result.Samples[0].Name != "jolokia_threads_peak" || result.Samples[0].Value != 437 {
+			t.Errorf("Expected the cached sample of the mapping that isn't due, got %+v", result.Samples)
+		}
+	}
+
+	if agent.Requests() != 2 {
+		t.Errorf("Expected 2 requests, got %d", agent.Requests())
+	}
+}
+
+func TestClient_ScrapeAllCached(t *testing.T) {
+	agent := newTestAgent(nil)
+	srv := httptest.NewServer(agent)
+	defer srv.Close()
+
+	config := &Config{
+		Metrics: []MetricMapping{
+			{Source: MetricSource{Mbean: "java.lang:type=Threading", Attribute: "ThreadCount"}, Target: "threads", Interval: Duration(time.Hour)},
+		},
+	}
+
+	client, err := NewClient(ClientOptions{Config: config, Namespace: Namespace, Target: TargetConfig{URL: srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		result, err := client.Scrape(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !result.Reached || len(result.Samples) != 1 || result.Samples[0].Value != 421 {
+			t.Errorf("Expected the cached sample of a reached endpoint, got %+v", result)
+		}
+	}
+
+	if agent.Requests() != 1 {
+		t.Errorf("Expected the endpoint to be requested once, got %d requests", agent.Requests())
+	}
+}
@@ -0,0 +1,50 @@
+package jolokia
+
+import "fmt"
+
+// A NameCollision is reported for every sample of a scrape whose name and labels were
+// already used by another sample, e.g. because the CompositeData keys HeapMemory and heap_memory or two
+// different paths flatten to the same name.
+type NameCollision struct {
+	Name    string
+	Mbean   string
+	Mapping *MetricMapping
+}
+
+// resolveCollisions resolves samples with the same name using the given strategy. With
+// CollisionFirst the first sample is kept, with CollisionLast the last one, CollisionSuffix
+// keeps all samples and appends _2, _3, ... to the names of the later ones.
+func resolveCollisions(samples []Sample, strategy string) ([]Sample, []NameCollision) {
+	collisions := make([]NameCollision, 0)
+	result := make([]Sample, 0, len(samples))
+	index := make(map[string]int, len(samples))
+
+	for _, s := range samples {
+		i, ok := index[seriesName(s.Name, s.Labels)]
+		if !ok {
+			index[seriesName(s.Name, s.Labels)] = len(result)
+			result = append(result, s)
+			continue
+		}
+
+		collisions = append(collisions, NameCollision{Name: s.Name, Mbean: s.Mbean, Mapping: s.Mapping})
+
+		switch strategy {
+		case CollisionLast:
+			result[i] = s
+		case CollisionSuffix:
+			for n := 2; ; n++ {
+				name := fmt.Sprintf("%s_%d", s.Name, n)
+				if _, ok := index[seriesName(name, s.Labels)]; !ok {
+					s.Name = name
+					break
+				}
+			}
+
+			index[seriesName(s.Name, s.Labels)] = len(result)
+			result = append(result, s)
+		}
+	}
+
+	return result, collisions
+}
@@ -0,0 +1,89 @@
+package jolokia
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestResolveCollisions(t *testing.T) {
+	samples := []Sample{
+		{Name: "jolokia_heap_memory", Value: 1},
+		{Name: "jolokia_heap_memory", Value: 2},
+		{Name: "jolokia_heap_memory_2", Value: 3},
+		{Name: "jolokia_heap_memory", Value: 4},
+	}
+
+	tests := []struct {
+		strategy string
+		expected map[string]float64
+	}{
+		{"", map[string]float64{"jolokia_heap_memory": 1, "jolokia_heap_memory_2": 3}},
+		{CollisionFirst, map[string]float64{"jolokia_heap_memory": 1, "jolokia_heap_memory_2": 3}},
+		{CollisionLast, map[string]float64{"jolokia_heap_memory": 4, "jolokia_heap_memory_2": 3}},
+		{CollisionSuffix, map[string]float64{"jolokia_heap_memory": 1, "jolokia_heap_memory_2": 2, "jolokia_heap_memory_2_2": 3, "jolokia_heap_memory_3": 4}},
+	}
+
+	for _, test := range tests {
+		result, collisions := resolveCollisions(samples, test.strategy)
+
+		values := make(map[string]float64, len(result))
+		for _, s := range result {
+			values[s.Name] = s.Value
+		}
+
+		if len(values) != len(result) || !reflect.DeepEqual(values, test.expected) {
+			t.Errorf("Expected strategy %q to result in %v, got %+v", test.strategy, test.expected, result)
+		}
+
+		// with the suffix strategy, jolokia_heap_memory_2 collides with the renamed second sample
+		expectedCollisions := 2
+		if test.strategy == CollisionSuffix {
+			expectedCollisions = 3
+		}
+		if len(collisions) != expectedCollisions {
+			t.Errorf("Expected strategy %q to report %d collisions, got %d", test.strategy, expectedCollisions, len(collisions))
+		}
+	}
+}
+
+func TestClient_ScrapeCollisions(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{
+  "request": {"mbean": "java.lang:type=Memory", "attribute": "HeapMemoryUsage", "type": "read"},
+  "value": {"HeapMemory": 1, "heap_memory": 2},
+  "status": 200
+}]`)
+	}))
+	defer agent.Close()
+
+	config := &Config{
+		CollisionStrategy: CollisionSuffix,
+		Metrics: []MetricMapping{{
+			Source: MetricSource{Mbean: "java.lang:type=Memory", Attribute: "HeapMemoryUsage"},
+			Target: "java_memory",
+		}},
+	}
+
+	client, err := NewClient(ClientOptions{Config: config, Namespace: Namespace, Target: TargetConfig{URL: agent.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.Scrape(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Samples) != 2 || result.Samples[0].Name != "jolokia_java_memory_heap_memory" || result.Samples[0].Value != 1 ||
+		result.Samples[1].Name != "jolokia_java_memory_heap_memory_2" || result.Samples[1].Value != 2 {
+		t.Errorf("Expected colliding values to be suffixed, got %+v", result.Samples)
+	}
+
+	if len(result.Collisions) != 1 || result.Collisions[0].Name != "jolokia_java_memory_heap_memory" || result.Collisions[0].Mbean != "java.lang:type=Memory" {
+		t.Errorf("Expected a single collision to be reported, got %+v", result.Collisions)
+	}
+}
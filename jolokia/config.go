@@ -1,15 +1,23 @@
 package jolokia
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
+	"regexp"
 
 	"github.com/ghodss/yaml"
 	"strings"
 	"sort"
 )
 
+var envRegExp = regexp.MustCompile(`\$\$\{|\$\{([a-zA-Z_][a-zA-Z0-9_]*)(:-([^}]*))?\}`)
+
+const unknownFieldPrefix = "json: unknown field "
+
 // LoadConfig reads a file and returns the contained config
 func LoadConfig(file string) (*Config, error) {
 	b, err := ioutil.ReadFile(file)
@@ -17,34 +25,268 @@ func LoadConfig(file string) (*Config, error) {
 		return nil, err
 	}
 
+	b, err = expandEnv(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines map[string]int
 	if ext := path.Ext(file); ext == ".yaml" || ext == ".yml" {
+		lines = yamlLines(b)
+
 		b, err = yaml.YAMLToJSON(b)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	config := &Config{}
-	if err = json.Unmarshal(b, config); err != nil {
+	config := &Config{lines: lines}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(config); err != nil {
+		return nil, config.decodeError(err)
+	}
+
+	if config.Metrics, err = presetMetrics(config.Metrics, config.Presets...); err != nil {
 		return nil, err
 	}
+	fixMbeanNames(config.Metrics)
+
+	for name, module := range config.Modules {
+		if module.Metrics, err = presetMetrics(module.Metrics, module.Presets...); err != nil {
+			return nil, fmt.Errorf("error in module %s: %v", name, err)
+		}
+		fixMbeanNames(module.Metrics)
+		config.Modules[name] = module
+	}
 
-	fixMbeanNames(config)
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 
 	return config, nil
 }
 
+// decodeError adds the line of an unknown field to the error of the strict decoding
+func (c *Config) decodeError(err error) error {
+	if !strings.HasPrefix(err.Error(), unknownFieldPrefix) {
+		return err
+	}
+
+	field := strings.Trim(strings.TrimPrefix(err.Error(), unknownFieldPrefix), `"`)
+
+	paths := make([]string, 0)
+	for path := range c.lines {
+		if path == field || strings.HasSuffix(path, "."+field) {
+			paths = append(paths, path)
+		}
+	}
+
+	if len(paths) == 0 {
+		return fmt.Errorf("unknown field %q", field)
+	}
+
+	sort.Slice(paths, func(i, j int) bool {
+		return c.lines[paths[i]] < c.lines[paths[j]]
+	})
+
+	return ValidationError{Path: paths[0], Line: c.lines[paths[0]], Message: "unknown field"}
+}
+
+// ModuleMetrics returns the metrics of the module with the given name. An empty
+// name refers to the top level metrics of the config.
+func (c *Config) ModuleMetrics(name string) ([]MetricMapping, error) {
+	if name == "" {
+		return c.Metrics, nil
+	}
+
+	module, ok := c.Modules[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown module %q", name)
+	}
+
+	return module.Metrics, nil
+}
+
+// expandEnv replaces ${VAR} and ${VAR:-default} references with the value of the
+// environment variable VAR. If VAR is not set but VAR_FILE is, the content of the
+// file VAR_FILE points to is used, which allows secrets to be mounted as files.
+// A literal ${ can be written as $${. Values are inserted verbatim, so they have to
+// be quoted in the config if they contain characters that are special to YAML.
+// References in comments are left alone, so commented out settings may refer to
+// variables that aren't set.
+func expandEnv(b []byte) ([]byte, error) {
+	result := make([]byte, 0, len(b))
+	for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+		comment := commentStart(line)
+
+		expanded, err := expandEnvReferences(line[:comment])
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, expanded...)
+		result = append(result, line[comment:]...)
+	}
+
+	return result, nil
+}
+
+// commentStart returns the index of the YAML comment of a line, a # at the start of the
+// line or after whitespace that isn't within a quoted scalar. Without comment the length
+// of the line is returned.
+func commentStart(line []byte) int {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || bytes.IndexByte([]byte(" \t[{,:"), line[i-1]) >= 0):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return i
+		}
+	}
+
+	return len(line)
+}
+
+// expandEnvReferences replaces the references within a part of the config, see expandEnv
+func expandEnvReferences(b []byte) ([]byte, error) {
+	var expandErr error
+
+	result := envRegExp.ReplaceAllFunc(b, func(match []byte) []byte {
+		if expandErr != nil {
+			return match
+		}
+
+		groups := envRegExp.FindSubmatch(match)
+		if groups[1] == nil {
+			return []byte("${")
+		}
+
+		name := string(groups[1])
+		value, ok, err := lookupEnv(name)
+		if err != nil {
+			expandErr = err
+			return match
+		}
+
+		if !ok {
+			if groups[2] == nil {
+				expandErr = fmt.Errorf("config references undefined environment variable %q", name)
+				return match
+			}
+
+			return groups[3]
+		}
+
+		return []byte(value)
+	})
+
+	if expandErr != nil {
+		return nil, expandErr
+	}
+
+	return result, nil
+}
+
+// lookupEnv returns the value of the environment variable name, falling back to the
+// content of the file referenced by name_FILE.
+func lookupEnv(name string) (string, bool, error) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true, nil
+	}
+
+	file, ok := os.LookupEnv(name + "_FILE")
+	if !ok {
+		return "", false, nil
+	}
+
+	value, err := readSecretFile(file)
+	if err != nil {
+		return "", false, fmt.Errorf("unable to read %s_FILE: %v", name, err)
+	}
+
+	return value, true, nil
+}
+
+// readSecretFile returns the content of a secret file without trailing newlines
+func readSecretFile(file string) (string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
 // fixMeanNames sorts the request string of a mbean, e.g. from
 // java.lang:type=GarbageCollector,name=* to java.lang:name=*,type=GarbageCollector
-func fixMbeanNames(config *Config) {
-	for index, m := range config.Metrics {
-		parts := strings.Split(m.Source.Mbean, ":")
-		if len(parts) == 1 {
-			continue
+func fixMbeanNames(metrics []MetricMapping) {
+	for index, m := range metrics {
+		metrics[index].Source.Mbean = sortMbeanName(m.Source.Mbean)
+	}
+}
+
+func sortMbeanName(mbean string) string {
+	parts := strings.SplitN(mbean, ":", 2)
+	if len(parts) == 1 {
+		return mbean
+	}
+
+	fields := splitKeyProperties(parts[1])
+	sort.Strings(fields)
+	return strings.Join([]string{parts[0], strings.Join(fields, ",")}, ":")
+}
+
+// isMbeanPattern returns whether the mbean name is a pattern matching multiple mbeans
+func isMbeanPattern(mbean string) bool {
+	return strings.ContainsAny(mbean, "*?")
+}
+
+// splitKeyProperties splits the key properties of a mbean name at the commas that aren't
+// within a quoted value, e.g. type=Cache,name="a,b" into type=Cache and name="a,b"
+func splitKeyProperties(properties string) []string {
+	var fields []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(properties); i++ {
+		switch c := properties[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			fields = append(fields, properties[start:i])
+			start = i + 1
 		}
+	}
+
+	return append(fields, properties[start:])
+}
 
-		fields := strings.Split(parts[1], ",")
-		sort.Strings(fields)
-		config.Metrics[index].Source.Mbean = strings.Join([]string{parts[0], strings.Join(fields, ",")}, ":")
+// mbeanProperties returns the key properties of a mbean name, e.g. type and name of
+// java.lang:type=GarbageCollector,name=G1 Young Generation
+func mbeanProperties(mbean string) map[string]string {
+	properties := make(map[string]string)
+
+	parts := strings.SplitN(mbean, ":", 2)
+	if len(parts) == 1 {
+		return properties
 	}
+
+	for _, field := range splitKeyProperties(parts[1]) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) == 2 && kv[0] != "" {
+			properties[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+
+	return properties
 }
@@ -1,6 +1,13 @@
 package jolokia
 
-import "testing"
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
 var expectedConfig = &Config{
 	Metrics: []MetricMapping{
@@ -71,3 +78,303 @@ func checkConfig(t *testing.T, config *Config) {
 		}
 	}
 }
+
+func TestLoadConfigEnvExpansion(t *testing.T) {
+	secret, err := ioutil.TempFile("", "jolokia_secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(secret.Name())
+	fmt.Fprintln(secret, "java_memory")
+	secret.Close()
+
+	os.Setenv("JOLOKIA_TEST_MBEAN", "java.lang:type=Memory")
+	os.Setenv("JOLOKIA_TEST_TARGET_FILE", secret.Name())
+	defer os.Unsetenv("JOLOKIA_TEST_MBEAN")
+	defer os.Unsetenv("JOLOKIA_TEST_TARGET_FILE")
+
+	config, err := loadConfigString(t, `metrics:
+- source:
+    mbean: ${JOLOKIA_TEST_MBEAN}
+    attribute: ${JOLOKIA_TEST_ATTRIBUTE:-HeapMemoryUsage}
+    path: $${literal}
+  target: ${JOLOKIA_TEST_TARGET}
+`)
+	if err != nil {
+		t.Fatal("Error loading config file:", err)
+	}
+
+	source := config.Metrics[0].Source
+	if source.Mbean != "java.lang:type=Memory" {
+		t.Errorf("Expected Source.Mbean to be expanded, got %s", source.Mbean)
+	}
+	if source.Attribute != "HeapMemoryUsage" {
+		t.Errorf("Expected Source.Attribute to use the default, got %s", source.Attribute)
+	}
+	if source.Path != "${literal}" {
+		t.Errorf("Expected Source.Path to be escaped, got %s", source.Path)
+	}
+	if config.Metrics[0].Target != "java_memory" {
+		t.Errorf("Expected Target to be read from file, got %s", config.Metrics[0].Target)
+	}
+}
+
+func TestLoadConfigEnvExpansionUndefined(t *testing.T) {
+	_, err := loadConfigString(t, "metrics:\n- target: ${JOLOKIA_TEST_UNDEFINED}\n")
+	if err == nil || !strings.Contains(err.Error(), "JOLOKIA_TEST_UNDEFINED") {
+		t.Fatalf("Expected error about undefined variable, got %v", err)
+	}
+}
+
+func TestLoadConfigEnvExpansionComments(t *testing.T) {
+	os.Setenv("JOLOKIA_TEST_TARGET", "threads")
+	defer os.Unsetenv("JOLOKIA_TEST_TARGET")
+
+	config, err := loadConfigString(t, `# maxSeries: ${JOLOKIA_TEST_UNDEFINED}
+metrics:
+- source:
+    mbean: "java.lang:type=Threading # ${JOLOKIA_TEST_TARGET}"
+    attribute: ThreadCount # ${JOLOKIA_TEST_UNDEFINED}
+    path: count#${JOLOKIA_TEST_TARGET}
+  target: ${JOLOKIA_TEST_TARGET}
+`)
+	if err != nil {
+		t.Fatal("Error loading config file:", err)
+	}
+
+	metric := config.Metrics[0]
+	if metric.Source.Mbean != "java.lang:type=Threading # threads" || metric.Source.Attribute != "ThreadCount" || metric.Source.Path != "count#threads" {
+		t.Errorf("Expected references outside of comments to be expanded, got %+v", metric)
+	}
+}
+
+func loadConfigString(t *testing.T, content string) (*Config, error) {
+	dir, err := ioutil.TempDir("", "jolokia_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return LoadConfig(file)
+}
+
+func TestLoadConfigTargets(t *testing.T) {
+	config, err := loadConfigString(t, `modules:
+  gc:
+    metrics:
+    - source:
+        mbean: java.lang:type=GarbageCollector,name=*
+      target: java_gc
+targets:
+- name: app
+  url: https://app:8778/jolokia
+  module: gc
+  basicAuth:
+    username: admin
+    passwordFile: /run/secrets/jolokia
+  tls:
+    insecureSkipVerify: true
+  labels:
+    env: prod
+`)
+	if err != nil {
+		t.Fatal("Error loading config file:", err)
+	}
+
+	if len(config.Targets) != 1 {
+		t.Fatalf("Expected config to contain 1 target, but found %d", len(config.Targets))
+	}
+
+	target := config.Targets[0]
+	if target.Name != "app" || target.URL != "https://app:8778/jolokia" || target.Module != "gc" {
+		t.Errorf("Unexpected target: %+v", target)
+	}
+	if target.BasicAuth == nil || target.BasicAuth.Username != "admin" || target.BasicAuth.PasswordFile != "/run/secrets/jolokia" {
+		t.Errorf("Unexpected basic auth: %+v", target.BasicAuth)
+	}
+	if !target.TLS.InsecureSkipVerify {
+		t.Error("Expected insecureSkipVerify to be set")
+	}
+	if target.Labels["env"] != "prod" {
+		t.Errorf("Unexpected labels: %v", target.Labels)
+	}
+
+	metrics, err := config.ModuleMetrics(target.Module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 1 || metrics[0].Source.Mbean != "java.lang:name=*,type=GarbageCollector" {
+		t.Errorf("Unexpected module metrics: %+v", metrics)
+	}
+}
+
+func TestLoadConfigPresets(t *testing.T) {
+	config, err := loadConfigString(t, `presets: [jvm]
+metrics:
+- source:
+    mbean: java.lang:type=Threading
+    attribute: ThreadCount
+  target: custom_thread_count
+modules:
+  kafka:
+    presets: [jvm, kafka]
+`)
+	if err != nil {
+		t.Fatal("Error loading config file:", err)
+	}
+
+	if len(config.Metrics) != len(presets["jvm"]) {
+		t.Fatalf("Expected config to contain %d metrics, but found %d", len(presets["jvm"]), len(config.Metrics))
+	}
+
+	if config.Metrics[0].Target != "custom_thread_count" {
+		t.Errorf("Expected custom metric to be kept first, got %s", config.Metrics[0].Target)
+	}
+
+	for _, m := range config.Metrics[1:] {
+		if m.Source.Mbean == "java.lang:type=Threading" && m.Source.Attribute == "ThreadCount" {
+			t.Errorf("Expected preset metric to be replaced by custom metric, got %s", m.Target)
+		}
+		if m.Source.Mbean == "java.lang:type=GarbageCollector,name=*" {
+			t.Errorf("Expected mbean names of presets to be sorted, got %s", m.Source.Mbean)
+		}
+	}
+
+	if expected := len(presets["jvm"]) + len(presets["kafka"]); len(config.Modules["kafka"].Metrics) != expected {
+		t.Errorf("Expected module to contain %d metrics, but found %d", expected, len(config.Modules["kafka"].Metrics))
+	}
+
+	if err := config.AddPresets("unknown"); err == nil {
+		t.Error("Expected error adding unknown preset")
+	}
+}
+
+func TestLoadConfigUnknownField(t *testing.T) {
+	_, err := loadConfigString(t, `metrics:
+- source:
+    mbean: java.lang:type=Threading
+    attribute: ThreadCount
+  target: java_threading_thread_count
+  help: unknown
+`)
+	if err == nil || err.Error() != "line 6: metrics[0].help: unknown field" {
+		t.Fatalf("Expected unknown field error with line, got %v", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	_, err := loadConfigString(t, `metrics:
+- source:
+    mbean: java.lang:type=Threading
+    attribute: ThreadCount
+  target: java_threading_thread_count
+- source:
+    mbean: java.lang:type=Runtime
+    attribute: Uptime
+  target: java_threading_thread_count
+- source:
+    mbean: java.lang
+    attribute: Uptime
+  target: java-uptime
+- source:
+    mbean: java.lang:type=Memory
+    attribute: HeapMemoryUsage
+    path: used//
+  target: java_memory
+  interval: -5m
+targets:
+- name: app
+  url: http://app:8778/jolokia
+- name: app
+  url: app:8778
+  module: missing
+  labels:
+    target: other
+    mbean: other
+`)
+
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+
+	expected := []string{
+		`line 9: metrics[1].target: duplicate target "java_threading_thread_count", already used by metrics[0]`,
+		`line 13: metrics[2].target: invalid metric name "java-uptime"`,
+		`line 11: metrics[2].source.mbean: invalid mbean "java.lang", expected domain:key=value,...`,
+		`line 17: metrics[3].source.path: invalid path "used//", path segments must not be empty`,
+		`line 19: metrics[3].interval: interval must not be negative`,
+		`line 24: targets[1].url: invalid url "app:8778", expected an absolute http or https url`,
+		`line 25: targets[1].module: unknown module "missing"`,
+		`line 27: targets[1].labels.target: label "target" is reserved for the target name`,
+		`line 28: targets[1].labels.mbean: label "mbean" is reserved for the mapping source`,
+		`line 23: targets[1]: duplicate target "app", already defined by targets[0]`,
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d:\n%v", len(expected), len(errs), errs)
+	}
+
+	for i, e := range expected {
+		if errs[i].Error() != e {
+			t.Errorf("Expected error %q, got %q", e, errs[i].Error())
+		}
+	}
+}
+
+func TestValidateMbean(t *testing.T) {
+	tests := []struct {
+		mbean string
+		valid bool
+	}{
+		{"java.lang:type=Memory", true},
+		{"java.lang:type=GarbageCollector,name=*", true},
+		{"java.lang:type=GarbageCollector,*", true},
+		{`com.example:type=Cache,name="a,b"`, true},
+		{`com.example:type=Cache,name="a\",b=c"`, true},
+		{`com.example:name="a:b=c",type=Cache`, true},
+		{"java.lang", false},
+		{"java.lang:", false},
+		{"java.lang:type", false},
+		{"java.lang:type=Memory,type=Threading", false},
+		{`com.example:type=Cache,name="a,b`, false},
+		{`com.example:type=Cache,name="a"b"`, false},
+	}
+
+	for _, test := range tests {
+		if err := validateMbean(test.mbean); (err == nil) != test.valid {
+			t.Errorf("Expected mbean %s to be valid %v, got %v", test.mbean, test.valid, err)
+		}
+	}
+
+	if name := sortMbeanName(`com.example:type=Cache,name="a,b"`); name != `com.example:name="a,b",type=Cache` {
+		t.Errorf("Expected quoted values to be kept when sorting, got %s", name)
+	}
+	if properties := mbeanProperties(`com.example:type=Cache,name="a,b"`); properties["name"] != "a,b" {
+		t.Errorf("Expected the quoted name property, got %v", properties)
+	}
+}
+
+func TestConfigValidatePresets(t *testing.T) {
+	for _, name := range PresetNames() {
+		config := &Config{}
+		if err := config.AddPresets(name); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := config.Validate(); err != nil {
+			t.Errorf("Expected preset %s to be valid, got %v", name, err)
+		}
+
+		for _, m := range config.Metrics {
+			if strings.HasSuffix(m.Target, "_total") && m.Type != MetricTypeCounter {
+				t.Errorf("Expected mapping %s of preset %s to be a counter", m.Target, name)
+			}
+		}
+	}
+}
@@ -1,8 +1,54 @@
 package jolokia
 
+import "time"
+
 const (
 	// Namespace tells prometheus to export the metrics inside of a specific namespace
 	Namespace = "jolokia"
 
 	requestTypeRead = "read"
+
+	targetLabel = "target"
+	// mappingLabel holds the target of the mapping of per mapping metrics
+	mappingLabel = "mapping"
+	// mbeanLabel, attributeLabel and pathLabel hold the source of the mapping of per
+	// mapping metrics that have to tell mappings of the same target apart
+	mbeanLabel     = "mbean"
+	attributeLabel = "attribute"
+	pathLabel      = "path"
+
+	// MetricTypeGauge marks a metric mapping as gauge
+	MetricTypeGauge = "gauge"
+	// MetricTypeCounter marks a metric mapping as counter
+	MetricTypeCounter = "counter"
+
+	// CollisionFirst keeps the first of multiple samples with the same name
+	CollisionFirst = "first"
+	// CollisionLast keeps the last of multiple samples with the same name
+	CollisionLast = "last"
+	// CollisionSuffix keeps all samples with the same name, adding a numeric suffix
+	CollisionSuffix = "suffix"
+
+	// SinkTypeGraphite writes samples in the Graphite plaintext protocol
+	SinkTypeGraphite = "graphite"
+	// SinkTypeInflux writes samples in the InfluxDB line protocol
+	SinkTypeInflux = "influx"
+
+	// labels of discovered target groups that control how the jolokia url is built
+	schemeLabel      = "__scheme__"
+	metricsPathLabel = "__metrics_path__"
+	moduleLabel      = "__module__"
+
+	defaultMetricsPath     = "/jolokia"
+	defaultRefreshInterval = 30 * time.Second
+	defaultPushInterval    = 15 * time.Second
+	defaultPushTimeout     = 10 * time.Second
 )
+
+// sourceLabels are the labels of per mapping metrics, target labels must not use them
+var sourceLabels = map[string]bool{
+	mappingLabel:   true,
+	mbeanLabel:     true,
+	attributeLabel: true,
+	pathLabel:      true,
+}
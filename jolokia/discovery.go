@@ -0,0 +1,113 @@
+package jolokia
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// discoveredTargets converts the target groups found by a service discovery to
+// target configs. Addresses may either be complete urls or host:port pairs, for
+// which the url is built from the __scheme__ and __metrics_path__ labels. All
+// labels starting with __ are dropped. A group with an invalid label name fails the
+// discovery, so the previously discovered targets are kept.
+func discoveredTargets(groups []TargetGroup, defaults TargetDefaults) ([]TargetConfig, error) {
+	targets := make([]TargetConfig, 0)
+
+	for _, group := range groups {
+		if err := validateGroupLabels(group.Labels); err != nil {
+			return nil, fmt.Errorf("invalid target group %v: %v", group.Targets, err)
+		}
+
+		for _, address := range group.Targets {
+			target := TargetConfig{
+				Name:      address,
+				BasicAuth: defaults.BasicAuth,
+				TLS:       defaults.TLS,
+				Module:    defaults.Module,
+				Labels:    make(map[string]string),
+			}
+
+			for name, value := range defaults.Labels {
+				target.Labels[name] = value
+			}
+
+			for name, value := range group.Labels {
+				if !strings.HasPrefix(name, "__") {
+					target.Labels[name] = value
+				}
+			}
+
+			if module, ok := group.Labels[moduleLabel]; ok {
+				target.Module = module
+			}
+
+			u, err := targetURL(address, group.Labels)
+			if err != nil {
+				return nil, err
+			}
+			target.URL = u
+
+			targets = append(targets, target)
+		}
+	}
+
+	return targets, nil
+}
+
+// validateGroupLabels checks the label names of a target group like the labels of
+// configured targets, as they become the labels of the samples
+func validateGroupLabels(labels map[string]string) error {
+	for _, name := range sortedKeys(labels) {
+		if strings.HasPrefix(name, "__") {
+			continue
+		}
+
+		if !labelNameRegExp.MatchString(name) {
+			return fmt.Errorf("invalid label name %q", name)
+		} else if name == targetLabel {
+			return fmt.Errorf("label %q is reserved for the target name", name)
+		} else if sourceLabels[name] {
+			return fmt.Errorf("label %q is reserved for the mapping source", name)
+		}
+	}
+
+	return nil
+}
+
+func targetURL(address string, labels map[string]string) (string, error) {
+	if strings.Contains(address, "://") {
+		if _, err := url.Parse(address); err != nil {
+			return "", fmt.Errorf("invalid target url %q: %v", address, err)
+		}
+
+		return address, nil
+	}
+
+	scheme := labels[schemeLabel]
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	metricsPath := labels[metricsPathLabel]
+	if metricsPath == "" {
+		metricsPath = defaultMetricsPath
+	}
+
+	u := url.URL{Scheme: scheme, Host: address, Path: metricsPath}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("invalid target address %q", address)
+	}
+
+	return u.String(), nil
+}
+
+// refreshInterval returns the given interval or the default if none is configured
+func refreshInterval(interval Duration) time.Duration {
+	if interval <= 0 {
+		return defaultRefreshInterval
+	}
+
+	return time.Duration(interval)
+}
@@ -1,72 +1,91 @@
 package jolokia
 
 import (
-	"fmt"
+	"context"
 	"net/http"
 	"sync"
 	"time"
 
-	"crypto/tls"
-
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/log"
-	"encoding/json"
-	"bytes"
-	"io/ioutil"
 )
 
-// Exporter exports jolokia metrics for prometheus.
+const (
+	upHelp         = "Could jolokia endpoint be reached"
+	durationHelp   = "How long the jolokia endpoint took to deliver the metrics"
+	collisionsHelp = "How many samples had a name that was already used by another sample of the scrape"
+	sampleAgeHelp  = "How long ago the samples of a mapping with an interval were requested"
+	breakerHelp    = "State of the circuit breaker of the jolokia endpoint, 0 closed, 1 open, 2 half-open"
+)
+
+// Exporter exports jolokia metrics for prometheus. It's a thin adapter on top of a Client
+// adding the up and response duration metrics of the endpoint.
 type Exporter struct {
-	logger            log.Logger
-	namespace         string
-	URI               string
-	mutex             sync.Mutex
-	basicAuthUser     string
-	basicAuthPassword string
-
-	client   *http.Client
-	up       *prometheus.Desc
-	duration *prometheus.Desc
-
-	config        *Config
-	requestBody   []byte
-	metricMapping map[string]string
+	*Client
+	mutex sync.Mutex
+
+	up           *prometheus.Desc
+	duration     *prometheus.Desc
+	collisions   *prometheus.Desc
+	breakerState *prometheus.Desc
+
+	collisionCount float64
 }
 
 // NewExporter returns an initialized Exporter.
-func NewExporter(logger log.Logger, config *Config, namespace string, insecure bool, uri, basicAuthUser, basicAuthPassword string) (*Exporter, error) {
-	exporter := &Exporter{
-		config:            config,
-		logger:            logger,
-		URI:               uri,
-		namespace:         namespace,
-		basicAuthUser:     basicAuthUser,
-		basicAuthPassword: basicAuthPassword,
+func NewExporter(options ClientOptions) (*Exporter, error) {
+	client, err := NewClient(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Exporter{
+		Client: client,
 		up: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "", "up"),
-			"Could jolokia endpoint be reached",
+			prometheus.BuildFQName(options.Namespace, "", "up"),
+			upHelp,
 			nil,
-			nil),
+			options.Labels),
 		duration: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, "", "response_duration"),
-			"How long the jolokia endpoint took to deliver the metrics",
+			prometheus.BuildFQName(options.Namespace, "", "response_duration"),
+			durationHelp,
 			nil,
-			nil),
-		client: &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
-			},
-		},
-		metricMapping: make(map[string]string, 0),
-	}
+			options.Labels),
+		collisions: prometheus.NewDesc(
+			prometheus.BuildFQName(options.Namespace, "", "name_collisions_total"),
+			collisionsHelp,
+			nil,
+			options.Labels),
+		breakerState: prometheus.NewDesc(
+			prometheus.BuildFQName(options.Namespace, "", "circuit_breaker_state"),
+			breakerHelp,
+			nil,
+			options.Labels),
+	}, nil
+}
 
-	if err := exporter.prepare(config); err != nil {
-		return nil, err
+// NewTargetExporter returns an initialized Exporter for a target of the config. All metrics
+// of the exporter are labeled with the target name and the labels of the target.
+func NewTargetExporter(logger log.Logger, config *Config, namespace string, target TargetConfig) (*Exporter, error) {
+	return newTargetExporter(logger, config, namespace, target, nil)
+}
+
+func newTargetExporter(logger log.Logger, config *Config, namespace string, target TargetConfig, transport http.RoundTripper) (*Exporter, error) {
+	labels := prometheus.Labels{}
+	for name, value := range target.Labels {
+		labels[name] = value
 	}
 
-	logger.Debugf("Prepared jolokia request: %s", exporter.requestBody)
+	labels[targetLabel] = targetName(target)
 
-	return exporter, nil
+	return NewExporter(ClientOptions{
+		Logger:    logger,
+		Config:    config,
+		Namespace: namespace,
+		Target:    target,
+		Labels:    labels,
+		Transport: transport,
+	})
 }
 
 // Describe describes all the metrics ever exported by the jolokia endpoint exporter. It
@@ -74,109 +93,121 @@ func NewExporter(logger log.Logger, config *Config, namespace string, insecure b
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- e.up
 	ch <- e.duration
-}
+	ch <- e.collisions
 
-// Collect fetches the stats from configured location and delivers them
-// as Prometheus metrics.
-// It implements prometheus.Collector.
-func (e *Exporter) collect(ch chan<- prometheus.Metric) error {
-	req, err := http.NewRequest(http.MethodPost, e.URI, bytes.NewReader(e.requestBody))
-	if err != nil {
-		return err
+	if e.breaker.enabled() {
+		ch <- e.breakerState
 	}
 
-	req.SetBasicAuth(e.basicAuthUser, e.basicAuthPassword)
-	startTime := time.Now()
+	e.stats.describe(ch)
+}
+
+// scrape fetches the stats from configured location and returns them as samples. The
+// up and duration samples are returned even if the endpoint couldn't be scraped.
+func (e *Exporter) scrape() ([]Sample, error) {
+	result, err := e.Scrape(context.Background())
 
-	resp, err := e.client.Do(req)
-	ch <- prometheus.MustNewConstMetric(e.duration, prometheus.GaugeValue, time.Since(startTime).Seconds())
+	var up float64
+	if result.Reached {
+		up = 1
+	}
 
-	if err != nil {
-		ch <- prometheus.MustNewConstMetric(e.up, prometheus.GaugeValue, 0)
-		return fmt.Errorf("error scraping jolokia endpoint: %v", err)
+	samples := []Sample{
+		e.newSample(prometheus.BuildFQName(e.namespace, "", "response_duration"), durationHelp, prometheus.GaugeValue, result.Duration.Seconds()),
+		e.newSample(prometheus.BuildFQName(e.namespace, "", "up"), upHelp, prometheus.GaugeValue, up),
 	}
-	ch <- prometheus.MustNewConstMetric(e.up, prometheus.GaugeValue, 1)
+	samples[0].setDesc(e.duration)
+	samples[1].setDesc(e.up)
 
-	defer resp.Body.Close()
-	body, readErr := ioutil.ReadAll(resp.Body)
-	if readErr != nil {
-		return readErr
+	for _, mappingErr := range result.Errors {
+		e.logger.Errorf("%v", mappingErr)
 	}
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("there was an error, response code is %d, expected 200", resp.StatusCode)
+	for _, collision := range result.Collisions {
+		e.logger.Warnf("Name collision of %s from mbean %s", collision.Name, collision.Mbean)
 	}
 
-	var response Response
-	if err := json.Unmarshal(body, &response); err != nil {
-		return fmt.Errorf("error unmarshalling json data: %v", err)
+	e.collisionCount += float64(len(result.Collisions))
+	collisions := e.newSample(prometheus.BuildFQName(e.namespace, "", "name_collisions_total"), collisionsHelp, prometheus.CounterValue, e.collisionCount)
+	collisions.setDesc(e.collisions)
+	samples = append(samples, collisions)
+
+	if e.breaker.enabled() {
+		state := e.newSample(prometheus.BuildFQName(e.namespace, "", "circuit_breaker_state"), breakerHelp, prometheus.GaugeValue, float64(e.breaker.State()))
+		state.setDesc(e.breakerState)
+		samples = append(samples, state)
 	}
+	samples = append(samples, e.sampleAges(result.Samples)...)
 
-	e.logger.Debugf("Result has %d rows", len(response))
+	return append(samples, result.Samples...), err
+}
 
-	for _, metric := range response {
-		if metric.Status != 200 {
-			log.Errorf("unable to get metric for %s: %d %v %v", metric.Request.String(), metric.Status, metric.ErrorType, metric.Error)
+// sampleAges returns the age of the samples of every mapping with an interval, so cached
+// samples can be told from fresh ones. Mappings are told apart by their source, as several
+// mappings may share a target. The oldest sample of a mapping counts.
+func (e *Exporter) sampleAges(samples []Sample) []Sample {
+	now := time.Now()
+	var mappings []*MetricMapping
+	ages := make(map[MetricSource]time.Duration)
+	for _, s := range samples {
+		if s.Mapping == nil || s.Mapping.Interval <= 0 {
 			continue
 		}
 
-		target, ok := e.metricMapping[metric.Request.String()]
+		age := now.Sub(s.Timestamp)
+		oldest, ok := ages[s.Mapping.Source]
 		if !ok {
-			log.Errorf("Unable to find mapping for key %s", metric.Request.String())
-			continue
+			mappings = append(mappings, s.Mapping)
 		}
-
-		values, err := getValues(target, metric.Value)
-		if err != nil {
-			log.Warnf("Failed to handle value %s for metric %s as understandable value: %v", metric.Value, metric.Request.String(), err)
-			continue
+		if !ok || age > oldest {
+			ages[s.Mapping.Source] = age
 		}
+	}
 
-		for key, value := range values {
-			e.logger.Debugf("Adding key %s with value %v", key, value)
-
-			ch <- prometheus.MustNewConstMetric(
-				prometheus.NewDesc(
-					prometheus.BuildFQName(e.namespace, "", key),
-					key,
-					nil,
-					nil),
-				prometheus.UntypedValue,
-				value)
+	result := make([]Sample, 0, len(mappings))
+	for _, mapping := range mappings {
+		sample := e.newSample(prometheus.BuildFQName(e.namespace, "", "sample_age_seconds"), sampleAgeHelp, prometheus.GaugeValue, ages[mapping.Source].Seconds())
+		sample.Labels = make(map[string]string, len(e.labels)+4)
+		for name, value := range e.labels {
+			sample.Labels[name] = value
+		}
+		sample.Labels[mappingLabel] = mapping.Target
+		sample.Labels[mbeanLabel] = mapping.Source.Mbean
+		if mapping.Source.Attribute != "" {
+			sample.Labels[attributeLabel] = mapping.Source.Attribute
+		}
+		if mapping.Source.Path != "" {
+			sample.Labels[pathLabel] = mapping.Source.Path
 		}
 
+		result = append(result, sample)
 	}
 
-	return nil
+	return result
 }
 
-// Collects metrics, implements prometheus.Collector.
-func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+// Samples fetches the stats from configured location. Errors are logged, the returned
+// samples contain whatever could be collected.
+func (e *Exporter) Samples() []Sample {
+	waitStart := time.Now()
 	e.mutex.Lock() // To protect metrics from concurrent collects.
 	defer e.mutex.Unlock()
-	if err := e.collect(ch); err != nil {
+	e.stats.wait.Observe(time.Since(waitStart).Seconds())
+
+	samples, err := e.scrape()
+	if err != nil {
 		e.logger.Errorf("Error scraping jolokia endpoint: %s", err)
 	}
-	return
-}
 
-func (e *Exporter) prepare(config *Config) (error) {
-	req := Request{}
-
-	for _, m := range config.Metrics {
-		reqMetric := RequestMetric{
-			Type:      requestTypeRead,
-			Mbean:     m.Source.Mbean,
-			Attribute: m.Source.Attribute,
-			Path:      m.Source.Path,
-		}
+	return samples
+}
 
-		e.metricMapping[reqMetric.String()] = m.Target
-		log.Debugf("Adding mapping for %q to %q", reqMetric.String(), m.Target)
-		req = append(req, reqMetric)
+// Collects metrics, implements prometheus.Collector. The metrics instrumenting the scrapes
+// are collected as well.
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	for _, sample := range e.Samples() {
+		ch <- sample.Metric()
 	}
 
-	var err error
-	e.requestBody, err = json.Marshal(req)
-	return err
+	e.stats.collect(ch)
 }
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"net/http"
 	"net/http/httptest"
@@ -13,53 +14,66 @@ import (
 
 	"bytes"
 
-	"fmt"
+	"encoding/json"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/log"
+	"github.com/scalify/jolokia_exporter/jolokia/jolokiatest"
 )
 
+var (
+	testAgent     = newTestAgent(nil)
+	authTestAgent = newTestAgent(jolokiatest.BasicAuth("admin", "secret"))
+)
+
+// newTestAgent returns a fake agent serving the mbeans of fixtures/mbeans.json
+func newTestAgent(auth jolokiatest.AuthPolicy) *jolokiatest.Agent {
+	registry, err := jolokiatest.LoadRegistry(path.Join("fixtures", "mbeans.json"))
+	if err != nil {
+		panic(err)
+	}
+
+	agent := jolokiatest.NewAgent(registry)
+	agent.Auth = auth
+	return agent
+}
+
 func authTestHandler(w http.ResponseWriter, r *http.Request) {
-	if u, p, ok := r.BasicAuth(); !ok {
-		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprint(w, "Unauthorized")
-		return
-	} else if u != "admin" || p != "secret" {
-		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprint(w, "Wrong credentials")
-		return
-	}
-
-	w.Header().Add("Content-Type", "application/json")
-	http.ServeFile(w, r, path.Join("fixtures", "response.json"))
+	authTestAgent.ServeHTTP(w, r)
 }
 
 func checkRequestBody(t *testing.T, handlerFunc http.HandlerFunc) http.HandlerFunc {
-	expectedBody, err := ioutil.ReadFile(path.Join("fixtures", "request.json"))
+	b, err := ioutil.ReadFile(path.Join("fixtures", "request.json"))
 	if err != nil {
 		t.Fatalf("error reading request.json: %v", err)
 	}
 
+	expectedBody := bytes.NewBuffer(nil)
+	if err := json.Compact(expectedBody, b); err != nil {
+		t.Fatalf("error compacting request.json: %v", err)
+	}
+
 	return func(rw http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			t.Fatalf("error reading request body: %s", err)
+			t.Errorf("error reading request body: %s", err)
 		}
 
-		if bytes.Compare(expectedBody, b) != 0 {
-			t.Fatalf("Requested body does not match. Expected to get %s, but got %s", expectedBody, b)
+		if bytes.Compare(expectedBody.Bytes(), b) != 0 {
+			t.Errorf("Requested body does not match. Expected to get %s, but got %s", expectedBody, b)
 		}
 
+		r.Body = ioutil.NopCloser(bytes.NewReader(b))
+
 		handlerFunc(rw, r)
 	}
 }
 
 func testHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "application/json")
-	http.ServeFile(w, r, path.Join("fixtures", "response.json"))
+	testAgent.ServeHTTP(w, r)
 }
 
 func getPromResponse(t *testing.T) string {
@@ -73,7 +87,7 @@ func getPromResponse(t *testing.T) string {
 }
 
 func TestExporter_Describe(t *testing.T) {
-	exp, err := NewExporter(log.Base(), expectedConfig, Namespace, false, "http://test/test", "", "")
+	exp, err := NewExporter(ClientOptions{Logger: log.Base(), Config: expectedConfig, Namespace: Namespace, Target: TargetConfig{URL: "http://test/test"}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -81,8 +95,9 @@ func TestExporter_Describe(t *testing.T) {
 	c := make(chan *prometheus.Desc, 1024)
 	exp.Describe(c)
 
-	if len(c) != 2 {
-		t.Fatalf("Expected channel to have 2 objects, got %d", len(c))
+	// up, duration and collisions, followed by the 7 metrics instrumenting the scrapes
+	if len(c) != 10 {
+		t.Fatalf("Expected channel to have 10 objects, got %d", len(c))
 	}
 
 	up := <-c
@@ -94,6 +109,11 @@ func TestExporter_Describe(t *testing.T) {
 	if duration.String() != "Desc{fqName: \"jolokia_response_duration\", help: \"How long the jolokia endpoint took to deliver the metrics\", constLabels: {}, variableLabels: []}" {
 		t.Errorf("Unexpected duration metric description: %s", duration.String())
 	}
+
+	collisions := <-c
+	if collisions.String() != "Desc{fqName: \"jolokia_name_collisions_total\", help: \"How many samples had a name that was already used by another sample of the scrape\", constLabels: {}, variableLabels: []}" {
+		t.Errorf("Unexpected collisions metric description: %s", collisions.String())
+	}
 }
 
 func TestExporter_Collect_NoAuth(t *testing.T) {
@@ -102,7 +122,7 @@ func TestExporter_Collect_NoAuth(t *testing.T) {
 	buf := bytes.NewBufferString("")
 	logger := log.NewLogger(buf)
 	logger.SetLevel("warn")
-	exp, err := NewExporter(logger, expectedConfig, Namespace, false, srv.URL, "", "")
+	exp, err := NewExporter(ClientOptions{Logger: logger, Config: expectedConfig, Namespace: Namespace, Target: TargetConfig{URL: srv.URL}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -115,8 +135,9 @@ func TestExporter_Collect_NoAuth(t *testing.T) {
 		t.Fatalf("unexpect collect output: %v", bufStr)
 	}
 
-	if len(c) != 17 {
-		t.Fatalf("Expected channel to have 17 objects, got %d", len(c))
+	// 18 samples and 12 metrics instrumenting the scrape
+	if len(c) != 30 {
+		t.Fatalf("Expected channel to have 30 objects, got %d", len(c))
 	}
 }
 
@@ -126,7 +147,7 @@ func TestExporter_Collect_WithAuth(t *testing.T) {
 	logger.SetLevel("warn")
 
 	srv := httptest.NewServer(checkRequestBody(t, http.HandlerFunc(authTestHandler)))
-	exp, err := NewExporter(logger, expectedConfig, Namespace, false, srv.URL, "admin", "secret")
+	exp, err := NewExporter(ClientOptions{Logger: logger, Config: expectedConfig, Namespace: Namespace, Target: TargetConfig{URL: srv.URL, BasicAuth: &BasicAuth{Username: "admin", Password: "secret"}}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -139,8 +160,9 @@ func TestExporter_Collect_WithAuth(t *testing.T) {
 		t.Fatalf("unexpect collect output: %v", bufStr)
 	}
 
-	if len(c) != 17 {
-		t.Fatalf("Expected channel to have 17 objects, got %d", len(c))
+	// 18 samples and 12 metrics instrumenting the scrape
+	if len(c) != 30 {
+		t.Fatalf("Expected channel to have 30 objects, got %d", len(c))
 	}
 }
 
@@ -150,7 +172,7 @@ func TestExporter_Collect_WithAuthButNoneGiven(t *testing.T) {
 	logger.SetLevel("warn")
 
 	srv := httptest.NewServer(checkRequestBody(t, http.HandlerFunc(authTestHandler)))
-	exp, err := NewExporter(logger, expectedConfig, Namespace, false, srv.URL, "", "")
+	exp, err := NewExporter(ClientOptions{Logger: logger, Config: expectedConfig, Namespace: Namespace, Target: TargetConfig{URL: srv.URL}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -170,7 +192,7 @@ func TestExporter_Collect_WithAuthButWrongGiven(t *testing.T) {
 	logger.SetLevel("warn")
 
 	srv := httptest.NewServer(checkRequestBody(t, http.HandlerFunc(authTestHandler)))
-	exp, err := NewExporter(logger, expectedConfig, Namespace, false, srv.URL, "", "")
+	exp, err := NewExporter(ClientOptions{Logger: logger, Config: expectedConfig, Namespace: Namespace, Target: TargetConfig{URL: srv.URL}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -190,7 +212,7 @@ func TestExporter_Collect_WithPrometheus(t *testing.T) {
 	logger.SetLevel("warn")
 
 	fixtureSrv := httptest.NewServer(http.HandlerFunc(authTestHandler))
-	exp, err := NewExporter(logger, expectedConfig, Namespace, false, fixtureSrv.URL, "admin", "secret")
+	exp, err := NewExporter(ClientOptions{Logger: logger, Config: expectedConfig, Namespace: Namespace, Target: TargetConfig{URL: fixtureSrv.URL, BasicAuth: &BasicAuth{Username: "admin", Password: "secret"}}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -221,3 +243,56 @@ func TestExporter_Collect_WithPrometheus(t *testing.T) {
 		t.Errorf("expected body to contain metrics %s, but doesn't: %s", expectedBody, resBody)
 	}
 }
+
+func TestNewTargetExporter_UnknownModule(t *testing.T) {
+	_, err := NewTargetExporter(log.Base(), expectedConfig, Namespace, TargetConfig{Name: "app", URL: "http://test/test", Module: "missing"})
+	if err == nil {
+		t.Fatal("expected error for unknown module")
+	}
+}
+
+func TestExporter_SampleAge(t *testing.T) {
+	srv := httptest.NewServer(newTestAgent(nil))
+	defer srv.Close()
+
+	config := &Config{
+		Metrics: []MetricMapping{
+			{Source: MetricSource{Mbean: "java.lang:type=Threading", Attribute: "ThreadCount"}, Target: "threads"},
+			{Source: MetricSource{Mbean: "java.lang:type=GarbageCollector,name=*", Attribute: "CollectionCount"}, Target: "gc", Interval: Duration(time.Hour)},
+			{Source: MetricSource{Mbean: "java.lang:type=GarbageCollector,name=*", Attribute: "CollectionTime"}, Target: "gc", Interval: Duration(time.Hour)},
+		},
+	}
+
+	// the source labels are kept over target labels of the same name
+	exporter, err := NewTargetExporter(log.Base(), config, Namespace, TargetConfig{Name: "app", URL: srv.URL, Labels: map[string]string{"env": "prod", "mbean": "other"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exporter.Samples()
+
+	// the cached samples were requested 90 seconds ago
+	for i := range exporter.requests[1].samples {
+		exporter.requests[1].samples[i].Timestamp = time.Now().Add(-90 * time.Second)
+	}
+
+	ages := make([]Sample, 0)
+	for _, s := range exporter.Samples() {
+		if s.Name == "jolokia_sample_age_seconds" {
+			ages = append(ages, s)
+		}
+	}
+
+	// the mappings of the same target are told apart by their source
+	if len(ages) != 2 || ages[0].Labels["mapping"] != "gc" || ages[0].Labels["attribute"] != "CollectionCount" || ages[1].Labels["attribute"] != "CollectionTime" {
+		t.Fatalf("Expected the sample ages of both mappings gc, got %+v", ages)
+	}
+	if ages[0].Labels["target"] != "app" || ages[0].Labels["env"] != "prod" || ages[0].Labels["mbean"] != "java.lang:type=GarbageCollector,name=*" {
+		t.Errorf("Expected the labels of the target and the mbean, got %v", ages[0].Labels)
+	}
+	for _, age := range ages {
+		if age.Value < 90 || age.Value > 100 {
+			t.Errorf("Expected the cached samples to be 90 seconds old, got %v", age.Value)
+		}
+	}
+}
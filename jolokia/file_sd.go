@@ -0,0 +1,129 @@
+package jolokia
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/prometheus/common/log"
+)
+
+const fileSDSourcePrefix = "file_sd:"
+
+// FileDiscovery keeps the targets in sync with the target group files of a FileSDConfig.
+// Every file is a separate source of the targets, a file that can't be read keeps the
+// targets it had before. The files are polled rather than watched, so changes show up
+// within the refresh interval.
+type FileDiscovery struct {
+	logger  log.Logger
+	config  FileSDConfig
+	targets *Targets
+
+	files map[string]bool
+}
+
+// NewFileDiscovery returns a FileDiscovery that updates the given targets
+func NewFileDiscovery(logger log.Logger, config FileSDConfig, targets *Targets) *FileDiscovery {
+	return &FileDiscovery{
+		logger:  logger,
+		config:  config,
+		targets: targets,
+		files:   make(map[string]bool),
+	}
+}
+
+// Run refreshes the targets in the configured interval until stop is closed
+func (d *FileDiscovery) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(refreshInterval(d.config.RefreshInterval))
+	defer ticker.Stop()
+
+	for {
+		if err := d.Refresh(); err != nil {
+			d.logger.Errorf("Error refreshing file discovery: %v", err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh reads all files matching the configured patterns and updates the targets.
+// The last error that occurred is returned.
+func (d *FileDiscovery) Refresh() error {
+	var lastErr error
+
+	files := make(map[string]bool)
+	for _, pattern := range d.config.Files {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			lastErr = fmt.Errorf("invalid file pattern %q: %v", pattern, err)
+			continue
+		}
+
+		for _, file := range matches {
+			files[file] = true
+		}
+	}
+
+	for file := range files {
+		if err := d.refreshFile(file); err != nil {
+			lastErr = err
+		}
+	}
+
+	for file := range d.files {
+		if files[file] {
+			continue
+		}
+
+		if err := d.targets.Sync(fileSDSourcePrefix+file, nil); err != nil {
+			lastErr = err
+		}
+	}
+
+	d.files = files
+	return lastErr
+}
+
+func (d *FileDiscovery) refreshFile(file string) error {
+	groups, err := readTargetGroups(file)
+	if err != nil {
+		return fmt.Errorf("unable to read target groups from %s: %v", file, err)
+	}
+
+	targets, err := discoveredTargets(groups, d.config.TargetDefaults)
+	if err != nil {
+		return fmt.Errorf("invalid targets in %s: %v", file, err)
+	}
+
+	return d.targets.Sync(fileSDSourcePrefix+file, targets)
+}
+
+// readTargetGroups reads a json or yaml file in the file_sd format
+func readTargetGroups(file string) ([]TargetGroup, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if ext := path.Ext(file); ext == ".yaml" || ext == ".yml" {
+		b, err = yaml.YAMLToJSON(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	groups := make([]TargetGroup, 0)
+	if err := json.Unmarshal(b, &groups); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,125 @@
+package jolokia
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/log"
+)
+
+func TestFileDiscovery_Refresh(t *testing.T) {
+	agent1 := httptest.NewServer(http.HandlerFunc(testHandler))
+	defer agent1.Close()
+	agent2 := httptest.NewServer(http.HandlerFunc(testHandler))
+	defer agent2.Close()
+
+	dir, err := ioutil.TempDir("", "jolokia_file_sd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "targets.json")
+	writeFile := func(content string) {
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := &Config{Metrics: expectedConfig.Metrics[2:3]}
+	targets, err := NewTargets(log.Base(), config, Namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	discovery := NewFileDiscovery(log.Base(), FileSDConfig{
+		Files:          []string{filepath.Join(dir, "*.json")},
+		TargetDefaults: TargetDefaults{Labels: map[string]string{"env": "test"}},
+	}, targets)
+
+	agent2Address := strings.TrimPrefix(agent2.URL, "http://")
+	writeFile(fmt.Sprintf(`[
+  {"targets": [%q], "labels": {"dc": "a"}},
+  {"targets": [%q], "labels": {"dc": "b", "__metrics_path__": "/custom"}}
+]`, agent1.URL, agent2Address))
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	exporters := targets.Exporters()
+	if len(exporters) != 2 {
+		t.Fatalf("Expected 2 targets to be discovered, got %d", len(exporters))
+	}
+	if exporters[0].URI != agent2.URL+"/custom" {
+		t.Errorf("Expected url of host:port target to be built from labels, got %s", exporters[0].URI)
+	}
+
+	body := gatherTargets(t, targets)
+	for _, expected := range []string{
+		fmt.Sprintf(`jolokia_java_threading_thread_count{dc="a",env="test",target=%q} 421`, agent1.URL),
+		fmt.Sprintf(`jolokia_java_threading_thread_count{dc="b",env="test",target=%q} 421`, agent2Address),
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected body to contain %s, but doesn't: %s", expected, body)
+		}
+	}
+
+	writeFile(fmt.Sprintf(`[{"targets": [%q], "labels": {"dc": "a"}}]`, agent1.URL))
+	if err := discovery.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	if exporters := targets.Exporters(); len(exporters) != 1 || exporters[0].URI != agent1.URL {
+		t.Fatalf("Expected 1 target to remain, got %d", len(exporters))
+	}
+
+	writeFile(`not a target group`)
+	if err := discovery.Refresh(); err == nil {
+		t.Error("Expected error refreshing invalid file")
+	}
+
+	if exporters := targets.Exporters(); len(exporters) != 1 {
+		t.Fatalf("Expected targets of invalid file to be kept, got %d", len(exporters))
+	}
+
+	for _, labels := range []string{`{"foo-bar": "a"}`, `{"1x": "a"}`, `{"target": "a"}`} {
+		writeFile(fmt.Sprintf(`[{"targets": [%q], "labels": %s}]`, agent2.URL, labels))
+		if err := discovery.Refresh(); err == nil {
+			t.Errorf("Expected error refreshing target group with labels %s", labels)
+		}
+
+		if exporters := targets.Exporters(); len(exporters) != 1 || exporters[0].URI != agent1.URL {
+			t.Fatalf("Expected targets of a file with invalid labels to be kept, got %d", len(exporters))
+		}
+	}
+	gatherTargets(t, targets)
+
+	os.Remove(file)
+	if err := discovery.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	if exporters := targets.Exporters(); len(exporters) != 0 {
+		t.Fatalf("Expected targets of removed file to be retired, got %d", len(exporters))
+	}
+}
+
+func gatherTargets(t *testing.T, collector prometheus.Collector) string {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rw := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(rw, req)
+
+	return rw.Body.String()
+}
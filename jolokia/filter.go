@@ -0,0 +1,188 @@
+package jolokia
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// A keyFilter selects the values of a mapping by their key path, the keys of a value
+// below the mbean, attribute and path of the mapping joined like a jolokia path. Without
+// an attribute the key path starts with the attribute name, e.g. HeapMemoryUsage/used.
+type keyFilter struct {
+	include []keyPattern
+	exclude []keyPattern
+}
+
+// A keyPattern is a glob like HeapMemoryUsage/* or a regular expression enclosed in
+// slashes like /Collection(Count|Time)/. It matches a key path if it matches the whole
+// path or the path of one of its parents, so an attribute name matches all its values.
+type keyPattern struct {
+	glob   string
+	regExp *regexp.Regexp
+}
+
+// isRegExpPattern tells whether a pattern is a regular expression enclosed in slashes
+func isRegExpPattern(pattern string) bool {
+	return len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")
+}
+
+func compileKeyPattern(pattern string) (keyPattern, error) {
+	if pattern == "" {
+		return keyPattern{}, fmt.Errorf("pattern must not be empty")
+	}
+
+	if isRegExpPattern(pattern) {
+		re, err := regexp.Compile("^(?:" + pattern[1:len(pattern)-1] + ")$")
+		if err != nil {
+			return keyPattern{}, err
+		}
+
+		return keyPattern{regExp: re}, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return keyPattern{}, err
+	}
+
+	return keyPattern{glob: pattern}, nil
+}
+
+func (p keyPattern) match(keyPath string) bool {
+	if p.regExp != nil {
+		return p.regExp.MatchString(keyPath)
+	}
+
+	matched, _ := path.Match(p.glob, keyPath)
+	return matched
+}
+
+// newKeyFilter compiles the include and exclude patterns of a mapping, it returns nil if
+// there are none
+func newKeyFilter(m MetricMapping) (*keyFilter, error) {
+	if len(m.Include) == 0 && len(m.Exclude) == 0 {
+		return nil, nil
+	}
+
+	f := &keyFilter{}
+	for _, pattern := range m.Include {
+		p, err := compileKeyPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q of mapping %s: %v", pattern, m.Target, err)
+		}
+		f.include = append(f.include, p)
+	}
+	for _, pattern := range m.Exclude {
+		p, err := compileKeyPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q of mapping %s: %v", pattern, m.Target, err)
+		}
+		f.exclude = append(f.exclude, p)
+	}
+
+	return f, nil
+}
+
+// match tells whether a value with the keys is kept: it has to match an include pattern,
+// if there are any, and must not match an exclude pattern
+func (f *keyFilter) match(keys []string) bool {
+	paths := keyPaths(keys)
+	return (len(f.include) == 0 || matchAny(f.include, paths)) && !matchAny(f.exclude, paths)
+}
+
+// captures returns the submatches of the first regular expression include pattern
+// matching the key path of a value, or nil
+func (f *keyFilter) captures(keys []string) []string {
+	paths := keyPaths(keys)
+	for _, p := range f.include {
+		if p.regExp == nil {
+			continue
+		}
+
+		for _, keyPath := range paths {
+			if captures := p.regExp.FindStringSubmatch(keyPath); captures != nil {
+				return captures
+			}
+		}
+	}
+
+	return nil
+}
+
+// maxCapture returns the number of captures of the include pattern with the most of them
+func (f *keyFilter) maxCapture() int {
+	max := 0
+	for _, p := range f.include {
+		if p.regExp != nil && p.regExp.NumSubexp() > max {
+			max = p.regExp.NumSubexp()
+		}
+	}
+
+	return max
+}
+
+// keyPaths returns the key paths of the keys and of their parents, shortest first
+func keyPaths(keys []string) []string {
+	paths := make([]string, 0, len(keys))
+	keyPath := ""
+	for i, key := range keys {
+		if i > 0 {
+			keyPath += "/"
+		}
+		keyPath += escapePathSegment(key)
+		paths = append(paths, keyPath)
+	}
+
+	return paths
+}
+
+func matchAny(patterns []keyPattern, paths []string) bool {
+	for _, p := range patterns {
+		for _, keyPath := range paths {
+			if p.match(keyPath) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// escapePathSegment escapes a key like a segment of a jolokia path, see splitPath
+func escapePathSegment(key string) string {
+	if !strings.ContainsAny(key, "!/") {
+		return key
+	}
+
+	return strings.NewReplacer("!", "!!", "/", "!/").Replace(key)
+}
+
+// includedAttributes returns the attributes a mapping without attribute has to read, if
+// all its include patterns start with a literal attribute name. Then they are requested
+// as a list instead of all attributes of the mbean, otherwise nil is returned.
+func includedAttributes(m MetricMapping) []string {
+	if m.Source.Attribute != "" || len(m.Include) == 0 {
+		return nil
+	}
+
+	attributes := make([]string, 0, len(m.Include))
+	seen := make(map[string]bool)
+	for _, pattern := range m.Include {
+		if isRegExpPattern(pattern) {
+			return nil
+		}
+
+		segments := splitPath(pattern)
+		if len(segments) == 0 || segments[0] == "" || strings.ContainsAny(segments[0], `*?[\`) {
+			return nil
+		}
+
+		if !seen[segments[0]] {
+			seen[segments[0]] = true
+			attributes = append(attributes, segments[0])
+		}
+	}
+
+	return attributes
+}
@@ -0,0 +1,167 @@
+package jolokia
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestKeyFilter(t *testing.T) {
+	tests := []struct {
+		include  []string
+		exclude  []string
+		keys     []string
+		expected bool
+	}{
+		{nil, []string{"Arch"}, []string{"SystemCpuLoad"}, true},
+		{nil, []string{"Arch"}, []string{"Arch"}, false},
+		{[]string{"HeapMemoryUsage"}, nil, []string{"HeapMemoryUsage", "used"}, true},
+		{[]string{"HeapMemoryUsage/used"}, nil, []string{"HeapMemoryUsage", "max"}, false},
+		{[]string{"*MemoryUsage/*"}, []string{"*/committed"}, []string{"NonHeapMemoryUsage", "used"}, true},
+		{[]string{"*MemoryUsage/*"}, []string{"*/committed"}, []string{"NonHeapMemoryUsage", "committed"}, false},
+		{[]string{"*"}, nil, []string{"HeapMemoryUsage", "used"}, true},
+		{[]string{"/Collection(Count|Time)/"}, nil, []string{"CollectionTime"}, true},
+		{[]string{"/Collection(Count|Time)/"}, nil, []string{"LastCollectionTime"}, false},
+		{[]string{"/.*/used/"}, nil, []string{"HeapMemoryUsage", "used"}, true},
+		{[]string{"a!/b"}, nil, []string{"a/b"}, true},
+		{[]string{"a/b"}, nil, []string{"a/b"}, false},
+	}
+
+	for _, test := range tests {
+		f, err := newKeyFilter(MetricMapping{Include: test.include, Exclude: test.exclude})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if f.match(test.keys) != test.expected {
+			t.Errorf("Expected include %v and exclude %v to match %v: %t", test.include, test.exclude, test.keys, test.expected)
+		}
+	}
+
+	if f, _ := newKeyFilter(MetricMapping{}); f != nil {
+		t.Error("Expected no filter of a mapping without patterns")
+	}
+
+	for _, pattern := range []string{"", "[", "/(/"} {
+		if _, err := newKeyFilter(MetricMapping{Include: []string{pattern}}); err == nil {
+			t.Errorf("Expected pattern %q to be invalid", pattern)
+		}
+	}
+}
+
+func TestIncludedAttributes(t *testing.T) {
+	tests := []struct {
+		attribute string
+		include   []string
+		expected  []string
+	}{
+		{"", []string{"SystemCpuLoad", "HeapMemoryUsage/used", "HeapMemoryUsage/max"}, []string{"SystemCpuLoad", "HeapMemoryUsage"}},
+		{"", []string{"Process!/Cpu"}, []string{"Process/Cpu"}},
+		{"", []string{"SystemCpuLoad", "Process*"}, nil},
+		{"", []string{"SystemCpuLoad", "/Process.*/"}, nil},
+		{"", nil, nil},
+		{"HeapMemoryUsage", []string{"used"}, nil},
+	}
+
+	for _, test := range tests {
+		m := MetricMapping{Source: MetricSource{Mbean: "java.lang:type=OperatingSystem", Attribute: test.attribute}, Include: test.include}
+		if actual := includedAttributes(m); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Expected include %v to request attributes %v, got %v", test.include, test.expected, actual)
+		}
+	}
+}
+
+func TestClient_ScrapeFilters(t *testing.T) {
+	srv := httptest.NewServer(newTestAgent(nil))
+	defer srv.Close()
+
+	tests := []struct {
+		mapping    MetricMapping
+		attributes []string
+		expected   []string
+	}{
+		{
+			MetricMapping{Source: MetricSource{Mbean: "java.lang:type=OperatingSystem"}, Target: "os", Include: []string{"SystemLoadAverage", "AvailableProcessors"}},
+			[]string{"SystemLoadAverage", "AvailableProcessors"},
+			[]string{"jolokia_os_available_processors", "jolokia_os_system_load_average"},
+		},
+		{
+			MetricMapping{Source: MetricSource{Mbean: "java.lang:type=OperatingSystem"}, Target: "os", Include: []string{"/Process.*/"}, Exclude: []string{"ProcessCpuTime"}},
+			nil,
+			[]string{"jolokia_os_process_cpu_load"},
+		},
+		{
+			MetricMapping{Source: MetricSource{Mbean: "java.lang:type=Memory", Attribute: "HeapMemoryUsage"}, Target: "heap", Exclude: []string{"committed", "init"}},
+			nil,
+			[]string{"jolokia_heap_max", "jolokia_heap_used"},
+		},
+		{
+			MetricMapping{Source: MetricSource{Mbean: "java.lang:type=GarbageCollector,name=*"}, Target: "gc", Include: []string{"CollectionCount"}},
+			[]string{"CollectionCount"},
+			[]string{
+				"jolokia_gc_java_lang_name_g_1_old_generation_type_garbage_collector_collection_count",
+				"jolokia_gc_java_lang_name_g_1_young_generation_type_garbage_collector_collection_count",
+			},
+		},
+		{
+			MetricMapping{Source: MetricSource{Mbean: "java.lang:type=Memory,*", Attribute: "HeapMemoryUsage"}, Target: "memory", Include: []string{"used"}},
+			nil,
+			[]string{"jolokia_memory_java_lang_type_memory_heap_memory_usage_used"},
+		},
+	}
+
+	for _, test := range tests {
+		client, err := NewClient(ClientOptions{Config: &Config{Metrics: []MetricMapping{test.mapping}}, Namespace: Namespace, Target: TargetConfig{URL: srv.URL}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if attributes := client.requests[0].metric.Attributes; !reflect.DeepEqual(attributes, test.attributes) {
+			t.Errorf("%s: expected to request attributes %v, got %v", test.mapping.Target, test.attributes, attributes)
+		}
+
+		result, err := client.Scrape(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Errors) > 0 {
+			t.Errorf("%s: unexpected mapping errors %v", test.mapping.Target, result.Errors)
+		}
+
+		names := make([]string, 0, len(result.Samples))
+		for _, s := range result.Samples {
+			names = append(names, s.Name)
+		}
+		sort.Strings(names)
+
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%s: expected samples %v, got %v", test.mapping.Target, test.expected, names)
+		}
+	}
+}
+
+func TestConfigValidateKeyPatterns(t *testing.T) {
+	config := &Config{
+		Metrics: []MetricMapping{
+			{Source: MetricSource{Mbean: "java.lang:type=OperatingSystem"}, Target: "os", Include: []string{"System*", "["}, Exclude: []string{"/(/"}},
+		},
+	}
+
+	errs, ok := config.Validate().(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected validation errors, got %v", config.Validate())
+	}
+
+	expected := []string{"metrics[0].include[1]", "metrics[0].exclude[0]"}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %v", len(expected), errs)
+	}
+
+	for i, path := range expected {
+		if errs[i].Path != path {
+			t.Errorf("Expected an error of %s, got %v", path, errs[i])
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package jolokia
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var graphiteNodeRegExp = regexp.MustCompile("[^a-zA-Z0-9_-]")
+
+// graphiteFormat formats samples in the Graphite plaintext protocol. The metric path is
+// built from the prefix, the names and values of the labels ordered by label name and the
+// sample name, e.g. jolokia.env.prod.target.app-1.jolokia_java_threading_thread_count, so
+// series with different labels never share a path. Dots, whitespace and other characters
+// that would split or break a node are replaced by underscores, so a label value like
+// 10.0.0.1:8778 is a single node 10_0_0_1_8778.
+type graphiteFormat struct {
+	prefix string
+}
+
+func (f graphiteFormat) appendLine(b []byte, s Sample) []byte {
+	if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+		return b
+	}
+
+	nodes := make([]string, 0, 2*len(s.Labels)+2)
+	for _, node := range strings.Split(strings.Trim(f.prefix, "."), ".") {
+		if node != "" {
+			nodes = append(nodes, graphiteNode(node))
+		}
+	}
+
+	names := make([]string, 0, len(s.Labels))
+	for name := range s.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		nodes = append(nodes, graphiteNode(name), graphiteNode(s.Labels[name]))
+	}
+	nodes = append(nodes, graphiteNode(s.Name))
+
+	b = append(b, strings.Join(nodes, ".")...)
+	b = append(b, ' ')
+	b = strconv.AppendFloat(b, s.Value, 'g', -1, 64)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, s.Timestamp.Unix(), 10)
+	return append(b, '\n')
+}
+
+// graphiteNode replaces all characters that would break a node of a metric path, an empty
+// value becomes a single underscore so the path keeps its nodes
+func graphiteNode(value string) string {
+	if value == "" {
+		return "_"
+	}
+
+	return graphiteNodeRegExp.ReplaceAllString(value, "_")
+}
@@ -0,0 +1,76 @@
+package jolokia
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// newHTTPClient returns a http client using the given tls settings
+func newHTTPClient(config TLSConfig) (*http.Client, error) {
+	transport, err := NewTransport(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// NewTransport returns the http transport used for jolokia requests with the given tls
+// settings, e.g. to be wrapped by a Recorder
+func NewTransport(config TLSConfig) (http.RoundTripper, error) {
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}, nil
+}
+
+// credentials returns the user and password, reading the password file if one is configured
+func (a *BasicAuth) credentials() (string, string, error) {
+	if a == nil {
+		return "", "", nil
+	}
+
+	if a.PasswordFile == "" {
+		return a.Username, a.Password, nil
+	}
+
+	password, err := readSecretFile(a.PasswordFile)
+	return a.Username, password, err
+}
+
+func newTLSConfig(config TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.InsecureSkipVerify,
+		ServerName:         config.ServerName,
+	}
+
+	if config.CAFile != "" {
+		b, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ca file %s: %v", config.CAFile, err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("unable to use ca file %s: no certificates found", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate %s: %v", config.CertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
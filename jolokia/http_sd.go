@@ -0,0 +1,181 @@
+package jolokia
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+const httpSDSourcePrefix = "http_sd:"
+
+// HTTPDiscovery keeps the targets in sync with the target groups served by the endpoint
+// of a HTTPSDConfig. If the endpoint can't be reached, the last successfully discovered
+// targets are kept. HTTPDiscovery reports its refreshes as prometheus metrics.
+type HTTPDiscovery struct {
+	logger  log.Logger
+	config  HTTPSDConfig
+	targets *Targets
+
+	client            *http.Client
+	basicAuthUser     string
+	basicAuthPassword string
+
+	mutex       sync.Mutex
+	refreshes   float64
+	failures    float64
+	lastSuccess time.Time
+	targetCount int
+
+	refreshesDesc   *prometheus.Desc
+	failuresDesc    *prometheus.Desc
+	lastSuccessDesc *prometheus.Desc
+	targetsDesc     *prometheus.Desc
+}
+
+// NewHTTPDiscovery returns a HTTPDiscovery that updates the given targets
+func NewHTTPDiscovery(logger log.Logger, namespace string, config HTTPSDConfig, targets *Targets) (*HTTPDiscovery, error) {
+	client, err := newHTTPClient(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = refreshInterval(config.RefreshInterval)
+
+	user, password, err := config.BasicAuth.credentials()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read password file for %s: %v", config.URL, err)
+	}
+
+	labels := prometheus.Labels{"url": config.URL}
+
+	return &HTTPDiscovery{
+		logger:            logger,
+		config:            config,
+		targets:           targets,
+		client:            client,
+		basicAuthUser:     user,
+		basicAuthPassword: password,
+		refreshesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "sd_http", "refreshes_total"),
+			"How often the targets were requested from the discovery endpoint",
+			nil,
+			labels),
+		failuresDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "sd_http", "refresh_failures_total"),
+			"How often requesting the targets from the discovery endpoint failed",
+			nil,
+			labels),
+		lastSuccessDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "sd_http", "last_success_timestamp_seconds"),
+			"When the targets were last successfully requested from the discovery endpoint",
+			nil,
+			labels),
+		targetsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "sd_http", "targets"),
+			"How many targets were discovered by the last successful refresh",
+			nil,
+			labels),
+	}, nil
+}
+
+// Run refreshes the targets in the configured interval until stop is closed
+func (d *HTTPDiscovery) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(refreshInterval(d.config.RefreshInterval))
+	defer ticker.Stop()
+
+	for {
+		if err := d.Refresh(); err != nil {
+			d.logger.Errorf("Error refreshing http discovery: %v", err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh requests the target groups from the discovery endpoint and updates the targets
+func (d *HTTPDiscovery) Refresh() error {
+	targets, err := d.fetch()
+	if err == nil {
+		err = d.targets.Sync(httpSDSourcePrefix+d.config.URL, targets)
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.refreshes++
+	if err != nil {
+		d.failures++
+		return err
+	}
+
+	d.lastSuccess = time.Now()
+	d.targetCount = len(targets)
+	return nil
+}
+
+func (d *HTTPDiscovery) fetch() ([]TargetConfig, error) {
+	req, err := http.NewRequest(http.MethodGet, d.config.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if d.basicAuthUser != "" || d.basicAuthPassword != "" {
+		req.SetBasicAuth(d.basicAuthUser, d.basicAuthPassword)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting %s: %v", d.config.URL, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("there was an error requesting %s, response code is %d, expected 200", d.config.URL, resp.StatusCode)
+	}
+
+	groups := make([]TargetGroup, 0)
+	if err := json.Unmarshal(body, &groups); err != nil {
+		return nil, fmt.Errorf("error unmarshalling target groups from %s: %v", d.config.URL, err)
+	}
+
+	return discoveredTargets(groups, d.config.TargetDefaults)
+}
+
+// Describe implements prometheus.Collector.
+func (d *HTTPDiscovery) Describe(ch chan<- *prometheus.Desc) {
+	ch <- d.refreshesDesc
+	ch <- d.failuresDesc
+	ch <- d.lastSuccessDesc
+	ch <- d.targetsDesc
+}
+
+// Collect implements prometheus.Collector.
+func (d *HTTPDiscovery) Collect(ch chan<- prometheus.Metric) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var lastSuccess float64
+	if !d.lastSuccess.IsZero() {
+		lastSuccess = float64(d.lastSuccess.UnixNano()) / 1e9
+	}
+
+	ch <- prometheus.MustNewConstMetric(d.refreshesDesc, prometheus.CounterValue, d.refreshes)
+	ch <- prometheus.MustNewConstMetric(d.failuresDesc, prometheus.CounterValue, d.failures)
+	ch <- prometheus.MustNewConstMetric(d.lastSuccessDesc, prometheus.GaugeValue, lastSuccess)
+	ch <- prometheus.MustNewConstMetric(d.targetsDesc, prometheus.GaugeValue, float64(d.targetCount))
+}
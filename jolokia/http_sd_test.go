@@ -0,0 +1,94 @@
+package jolokia
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/log"
+)
+
+func TestHTTPDiscovery_Refresh(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(testHandler))
+	defer agent.Close()
+
+	failing := false
+	labels := `{"service": "billing"}`
+	sd := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "sd" || p != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `[{"targets": [%q], "labels": %s}]`, agent.URL, labels)
+	}))
+	defer sd.Close()
+
+	config := &Config{Metrics: expectedConfig.Metrics[2:3]}
+	targets, err := NewTargets(log.Base(), config, Namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	discovery, err := NewHTTPDiscovery(log.Base(), Namespace, HTTPSDConfig{
+		URL:       sd.URL,
+		BasicAuth: &BasicAuth{Username: "sd", Password: "secret"},
+	}, targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := discovery.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	if exporters := targets.Exporters(); len(exporters) != 1 || exporters[0].URI != agent.URL {
+		t.Fatalf("Expected agent to be discovered, got %d targets", len(exporters))
+	}
+
+	body := gatherTargets(t, targets)
+	expected := fmt.Sprintf(`jolokia_java_threading_thread_count{service="billing",target=%q} 421`, agent.URL)
+	if !strings.Contains(body, expected) {
+		t.Errorf("expected body to contain %s, but doesn't: %s", expected, body)
+	}
+
+	failing = true
+	if err := discovery.Refresh(); err == nil {
+		t.Fatal("Expected refresh to fail")
+	}
+
+	if exporters := targets.Exporters(); len(exporters) != 1 {
+		t.Fatalf("Expected last discovered targets to be kept, got %d", len(exporters))
+	}
+
+	// an invalid label name fails the refresh like an unreachable endpoint
+	failing = false
+	labels = `{"service": "billing", "service-name": "billing"}`
+	if err := discovery.Refresh(); err == nil {
+		t.Fatal("Expected refresh with an invalid label name to fail")
+	}
+
+	if exporters := targets.Exporters(); len(exporters) != 1 || exporters[0].labels["service"] != "billing" {
+		t.Fatalf("Expected last discovered targets to be kept, got %d", len(exporters))
+	}
+	gatherTargets(t, targets)
+
+	body = gatherTargets(t, discovery)
+	for _, expected := range []string{
+		fmt.Sprintf(`jolokia_sd_http_refreshes_total{url=%q} 3`, sd.URL),
+		fmt.Sprintf(`jolokia_sd_http_refresh_failures_total{url=%q} 2`, sd.URL),
+		fmt.Sprintf(`jolokia_sd_http_targets{url=%q} 1`, sd.URL),
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected body to contain %s, but doesn't: %s", expected, body)
+		}
+	}
+}
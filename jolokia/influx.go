@@ -0,0 +1,51 @@
+package jolokia
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	influxMeasurementReplacer = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagReplacer         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// influxFormat formats samples in the InfluxDB line protocol. The sample name is used as
+// measurement with a single value field. The key properties of the mbean and the labels of
+// the sample are added as tags, labels take precedence over key properties of the same name.
+type influxFormat struct{}
+
+func (f influxFormat) appendLine(b []byte, s Sample) []byte {
+	if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+		return b
+	}
+
+	tags := mbeanProperties(s.Mbean)
+	for name, value := range s.Labels {
+		tags[name] = value
+	}
+
+	names := make([]string, 0, len(tags))
+	for name, value := range tags {
+		if value != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	b = append(b, influxMeasurementReplacer.Replace(s.Name)...)
+	for _, name := range names {
+		b = append(b, ',')
+		b = append(b, influxTagReplacer.Replace(name)...)
+		b = append(b, '=')
+		b = append(b, influxTagReplacer.Replace(tags[name])...)
+	}
+
+	b = append(b, " value="...)
+	b = strconv.AppendFloat(b, s.Value, 'g', -1, 64)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, s.Timestamp.UnixNano(), 10)
+	return append(b, '\n')
+}
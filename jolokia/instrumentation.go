@@ -0,0 +1,136 @@
+package jolokia
+
+import (
+	"io"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// phases of a scrape, as exported by the scrape_phase_duration_seconds histogram
+const (
+	phaseHTTP    = "http"
+	phaseDecode  = "decode"
+	phaseFlatten = "flatten"
+)
+
+// reasons of dropped values, as exported by the dropped_values_total counter
+const (
+	dropNonNumeric = "non_numeric"
+	dropNull       = "null"
+)
+
+// clientStats instruments the scrapes of a client. The metrics carry the labels of the
+// client and are exported by the Exporter next to the samples, they are not pushed.
+type clientStats struct {
+	phases        *prometheus.HistogramVec
+	responseSize  prometheus.Histogram
+	samples       *prometheus.GaugeVec
+	dropped       *prometheus.CounterVec
+	lookupMisses  prometheus.Counter
+	wait          prometheus.Histogram
+	seriesDropped *prometheus.CounterVec
+}
+
+func newClientStats(namespace string, labels map[string]string) *clientStats {
+	return &clientStats{
+		phases: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   "exporter",
+			Name:        "scrape_phase_duration_seconds",
+			Help:        "How long the phases of a scrape took: the http request until the response headers, decoding the response and flattening its values into samples",
+			ConstLabels: labels,
+		}, []string{"phase"}),
+		responseSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   "exporter",
+			Name:        "response_size_bytes",
+			Help:        "How large the responses of the jolokia endpoint were",
+			Buckets:     prometheus.ExponentialBuckets(1024, 4, 8),
+			ConstLabels: labels,
+		}),
+		samples: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "exporter",
+			Name:        "mapping_samples",
+			Help:        "How many samples the mappings of a target emitted by the last scrape",
+			ConstLabels: labels,
+		}, []string{mappingLabel, mbeanLabel, attributeLabel, pathLabel}),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "exporter",
+			Name:        "dropped_values_total",
+			Help:        "How many values of responses were dropped, as they were not numeric or null",
+			ConstLabels: labels,
+		}, []string{"reason"}),
+		lookupMisses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "exporter",
+			Name:        "mapping_lookup_misses_total",
+			Help:        "How many responses did not match any request of the mappings",
+			ConstLabels: labels,
+		}),
+		wait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   "exporter",
+			Name:        "scrape_wait_duration_seconds",
+			Help:        "How long scrapes waited for a concurrent scrape of the same target to finish",
+			ConstLabels: labels,
+		}),
+		seriesDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "series_dropped_total",
+			Help:        "How many series of the mappings were dropped as they exceeded the series limits",
+			ConstLabels: labels,
+		}, []string{mappingLabel}),
+	}
+}
+
+// observeSamples sets the number of samples of every mapping in the samples of a scrape.
+// Mappings are told apart by their source, as several mappings may share a target.
+func (s *clientStats) observeSamples(samples []Sample) {
+	mappings := make(map[MetricSource]*MetricMapping)
+	counts := make(map[MetricSource]float64)
+	for _, sample := range samples {
+		if sample.Mapping != nil {
+			mappings[sample.Mapping.Source] = sample.Mapping
+			counts[sample.Mapping.Source]++
+		}
+	}
+
+	s.samples.Reset()
+	for source, count := range counts {
+		s.samples.WithLabelValues(mappings[source].Target, source.Mbean, source.Attribute, source.Path).Set(count)
+	}
+}
+
+func (s *clientStats) describe(ch chan<- *prometheus.Desc) {
+	s.phases.Describe(ch)
+	s.responseSize.Describe(ch)
+	s.samples.Describe(ch)
+	s.dropped.Describe(ch)
+	s.lookupMisses.Describe(ch)
+	s.wait.Describe(ch)
+	s.seriesDropped.Describe(ch)
+}
+
+func (s *clientStats) collect(ch chan<- prometheus.Metric) {
+	s.phases.Collect(ch)
+	s.responseSize.Collect(ch)
+	s.samples.Collect(ch)
+	s.dropped.Collect(ch)
+	s.lookupMisses.Collect(ch)
+	s.wait.Collect(ch)
+	s.seriesDropped.Collect(ch)
+}
+
+// countingReader counts the bytes read from a response
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,138 @@
+package jolokia
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// gatherFamilies registers the exporter and returns the gathered metric families by name
+func gatherFamilies(t *testing.T, exporter *Exporter) map[string]*dto.MetricFamily {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+
+	return byName
+}
+
+// labeledMetric returns the metric of the family with the label value, or nil
+func labeledMetric(family *dto.MetricFamily, name, value string) *dto.Metric {
+	if family == nil {
+		return nil
+	}
+
+	for _, metric := range family.Metric {
+		for _, label := range metric.Label {
+			if label.GetName() == name && label.GetValue() == value {
+				return metric
+			}
+		}
+	}
+
+	return nil
+}
+
+func TestExporter_Instrumentation(t *testing.T) {
+	srv := httptest.NewServer(newTestAgent(nil))
+	defer srv.Close()
+
+	exporter, err := NewTargetExporter(log.Base(), expectedConfig, Namespace, TargetConfig{Name: "app", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	families := gatherFamilies(t, exporter)
+
+	for _, phase := range []string{phaseHTTP, phaseDecode, phaseFlatten} {
+		metric := labeledMetric(families["jolokia_exporter_scrape_phase_duration_seconds"], "phase", phase)
+		if metric == nil {
+			t.Errorf("Expected a duration of the %s phase", phase)
+		} else if metric.Histogram.GetSampleCount() != 1 {
+			t.Errorf("Expected a single observation of the %s phase, got %d", phase, metric.Histogram.GetSampleCount())
+		}
+	}
+
+	if family := families["jolokia_exporter_response_size_bytes"]; family == nil {
+		t.Error("Expected the response size to be exported")
+	} else if sum := family.Metric[0].Histogram.GetSampleSum(); sum <= 0 {
+		t.Errorf("Expected a response size, got %v", sum)
+	}
+
+	if metric := labeledMetric(families["jolokia_exporter_mapping_samples"], mappingLabel, "java_os"); metric == nil {
+		t.Error("Expected the samples of mapping java_os to be counted")
+	} else if metric.Gauge.GetValue() != 12 {
+		t.Errorf("Expected 12 samples of mapping java_os, got %v", metric.Gauge.GetValue())
+	}
+
+	// Arch, Name, Version and ObjectName of the operating system
+	if metric := labeledMetric(families["jolokia_exporter_dropped_values_total"], "reason", dropNonNumeric); metric == nil {
+		t.Error("Expected dropped values to be counted")
+	} else if metric.Counter.GetValue() != 4 {
+		t.Errorf("Expected 4 dropped non numeric values, got %v", metric.Counter.GetValue())
+	}
+
+	if metric := labeledMetric(families["jolokia_exporter_mapping_samples"], targetLabel, "app"); metric == nil {
+		t.Error("Expected the instrumentation to carry the target label")
+	}
+}
+
+func TestClientStats_ObserveSamples(t *testing.T) {
+	stats := newClientStats(Namespace, nil)
+
+	count := &MetricMapping{Source: MetricSource{Mbean: "java.lang:name=*,type=GarbageCollector", Attribute: "CollectionCount"}, Target: "jvm_gc"}
+	collectionTime := &MetricMapping{Source: MetricSource{Mbean: "java.lang:name=*,type=GarbageCollector", Attribute: "CollectionTime"}, Target: "jvm_gc"}
+	stats.observeSamples([]Sample{{Mapping: count}, {Mapping: count}, {Mapping: collectionTime}})
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(stats.samples)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the mappings share a target, but are counted on their own
+	values := make(map[string]float64)
+	for _, metric := range families[0].Metric {
+		for _, label := range metric.Label {
+			if label.GetName() == attributeLabel {
+				values[label.GetValue()] = metric.Gauge.GetValue()
+			}
+		}
+	}
+
+	if len(values) != 2 || values["CollectionCount"] != 2 || values["CollectionTime"] != 1 {
+		t.Errorf("Expected the samples of both mappings jvm_gc, got %v", values)
+	}
+}
+
+func TestClient_LookupMisses(t *testing.T) {
+	client, err := NewClient(ClientOptions{Config: expectedConfig, Namespace: Namespace, Target: TargetConfig{URL: "http://test/test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `[{"request":{"type":"read","mbean":"java.lang:type=Runtime","attribute":"Uptime"},"value":1,"status":200}]`
+	if _, err := client.ScrapeResponse([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+
+	metric := &dto.Metric{}
+	if err := client.stats.lookupMisses.Write(metric); err != nil {
+		t.Fatal(err)
+	}
+	if metric.Counter.GetValue() != 1 {
+		t.Errorf("Expected a lookup miss, got %v", metric.Counter.GetValue())
+	}
+}
@@ -0,0 +1,592 @@
+// Package jolokiatest provides a fake Jolokia agent for integration tests. The agent serves
+// the MBeans of an in-memory Registry over the Jolokia protocol and can inject latency,
+// server errors and authentication failures.
+package jolokiatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// AgentVersion is the Jolokia agent version reported by version requests
+	AgentVersion = "1.5.0"
+	// ProtocolVersion is the Jolokia protocol version reported by version requests
+	ProtocolVersion = "7.2"
+)
+
+// Agent is a fake Jolokia agent serving the MBeans of a Registry. It handles read, list,
+// search, exec and version requests, posted as single or bulk requests or passed in the
+// URL of GET requests.
+type Agent struct {
+	Registry *Registry
+	// Auth authenticates requests, all requests are allowed if it's nil
+	Auth AuthPolicy
+	// BasePath is the path the agent is served at, it's trimmed from the URL of GET requests
+	BasePath string
+
+	mutex      sync.Mutex
+	latency    time.Duration
+	failures   int
+	failStatus int
+	requests   int
+}
+
+// NewAgent returns an Agent serving the MBeans of the registry
+func NewAgent(registry *Registry) *Agent {
+	return &Agent{Registry: registry}
+}
+
+// SetLatency delays all following responses by d
+func (a *Agent) SetLatency(d time.Duration) {
+	a.mutex.Lock()
+	a.latency = d
+	a.mutex.Unlock()
+}
+
+// FailRequests answers the next n requests with the given HTTP status code instead of a
+// Jolokia response. If n is negative, all requests fail until FailRequests is called again.
+func (a *Agent) FailRequests(n, status int) {
+	a.mutex.Lock()
+	a.failures = n
+	a.failStatus = status
+	a.mutex.Unlock()
+}
+
+// Requests returns the number of HTTP requests received by the agent
+func (a *Agent) Requests() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.requests
+}
+
+// ServeHTTP handles a single or bulk Jolokia request
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mutex.Lock()
+	a.requests++
+	latency := a.latency
+	failStatus := 0
+	if a.failures != 0 {
+		failStatus = a.failStatus
+		if a.failures > 0 {
+			a.failures--
+		}
+	}
+	a.mutex.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if failStatus != 0 {
+		http.Error(w, http.StatusText(failStatus), failStatus)
+		return
+	}
+
+	if a.Auth != nil {
+		if err := a.Auth.Authenticate(r); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+	}
+
+	var result interface{}
+	switch r.Method {
+	case http.MethodGet:
+		req, err := parseURL(strings.TrimPrefix(r.URL.Path, a.BasePath))
+		if err != nil {
+			result = errorResponse(nil, err)
+			break
+		}
+
+		raw, _ := json.Marshal(req)
+		result = a.handle(raw)
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result = a.handleBody(body)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleBody handles the body of a POST request, either a single request or a list of
+// requests answered with a list of responses
+func (a *Agent) handleBody(body []byte) interface{} {
+	if !bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		return a.handle(body)
+	}
+
+	var requests []json.RawMessage
+	if err := json.Unmarshal(body, &requests); err != nil {
+		return errorResponse(nil, badRequest("invalid bulk request: %v", err))
+	}
+
+	responses := make([]response, 0, len(requests))
+	for _, raw := range requests {
+		responses = append(responses, a.handle(raw))
+	}
+
+	return responses
+}
+
+// request is a single Jolokia request
+type request struct {
+	Type      string        `json:"type"`
+	MBean     string        `json:"mbean,omitempty"`
+	Attribute interface{}   `json:"attribute,omitempty"`
+	Path      string        `json:"path,omitempty"`
+	Operation string        `json:"operation,omitempty"`
+	Arguments []interface{} `json:"arguments,omitempty"`
+	// Config holds the processing parameters, of which ignoreErrors is supported
+	Config map[string]interface{} `json:"config,omitempty"`
+}
+
+// ignoreErrors tells whether the errors of single attributes are returned as their values
+func (req request) ignoreErrors() bool {
+	value := req.Config["ignoreErrors"]
+	return value == true || value == "true"
+}
+
+// response is a single Jolokia response, echoing the request as it was received
+type response struct {
+	Request   json.RawMessage `json:"request,omitempty"`
+	Value     interface{}     `json:"value,omitempty"`
+	Timestamp int64           `json:"timestamp,omitempty"`
+	Status    int             `json:"status"`
+	Error     string          `json:"error,omitempty"`
+	ErrorType string          `json:"error_type,omitempty"`
+}
+
+// agentError is an error answered with the given status and Java exception type
+type agentError struct {
+	status    int
+	errorType string
+	message   string
+}
+
+func (e *agentError) Error() string {
+	return e.errorType + " : " + e.message
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &agentError{http.StatusBadRequest, "java.lang.IllegalArgumentException", fmt.Sprintf(format, args...)}
+}
+
+func instanceNotFound(mbean string) error {
+	return &agentError{http.StatusNotFound, "javax.management.InstanceNotFoundException", mbean}
+}
+
+func attributeNotFound(format string, args ...interface{}) error {
+	return &agentError{http.StatusNotFound, "javax.management.AttributeNotFoundException", fmt.Sprintf(format, args...)}
+}
+
+func errorResponse(raw json.RawMessage, err error) response {
+	e, ok := err.(*agentError)
+	if !ok {
+		e = &agentError{http.StatusInternalServerError, "javax.management.MBeanException", err.Error()}
+	}
+
+	return response{
+		Request:   raw,
+		Status:    e.status,
+		Error:     e.Error(),
+		ErrorType: e.errorType,
+	}
+}
+
+func (a *Agent) handle(raw json.RawMessage) response {
+	var req request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return errorResponse(raw, badRequest("invalid request: %v", err))
+	}
+
+	var value interface{}
+	var err error
+	switch req.Type {
+	case "read":
+		value, err = a.read(req)
+	case "list":
+		value, err = a.list(req)
+	case "search":
+		value, err = a.search(req)
+	case "exec":
+		value, err = a.exec(req)
+	case "version":
+		value = map[string]interface{}{
+			"agent":    AgentVersion,
+			"protocol": ProtocolVersion,
+			"config":   map[string]string{},
+			"info": map[string]string{
+				"product": "jolokiatest",
+				"vendor":  "scalify",
+			},
+		}
+	default:
+		err = badRequest("unknown request type %q", req.Type)
+	}
+
+	if err != nil {
+		return errorResponse(raw, err)
+	}
+
+	return response{
+		Request:   raw,
+		Value:     value,
+		Timestamp: time.Now().Unix(),
+		Status:    http.StatusOK,
+	}
+}
+
+// read returns the requested attributes of a MBean. For patterns the values of all
+// matching MBeans are returned by MBean name, attributes missing on a MBean are skipped.
+// If errors are ignored, attributes that can't be read have their error as value.
+func (a *Agent) read(req request) (interface{}, error) {
+	attributes, single, err := req.attributes()
+	if err != nil {
+		return nil, err
+	}
+	path := splitPath(req.Path)
+
+	if isPattern(req.MBean) {
+		mbeans, err := a.Registry.match(req.MBean)
+		if err != nil {
+			return nil, badRequest("%v", err)
+		}
+
+		a.Registry.mutex.RLock()
+		defer a.Registry.mutex.RUnlock()
+
+		values := make(map[string]interface{})
+		for _, mbean := range mbeans {
+			if value, _ := readAttributes(mbean, attributes, path, true, false); len(value) > 0 {
+				values[mbean.Name] = value
+			}
+		}
+
+		if len(values) == 0 {
+			return nil, instanceNotFound(req.MBean)
+		}
+
+		return values, nil
+	}
+
+	a.Registry.mutex.RLock()
+	defer a.Registry.mutex.RUnlock()
+
+	mbean, err := a.Registry.lookup(req.MBean)
+	if err != nil {
+		return nil, instanceNotFound(req.MBean)
+	}
+
+	if single {
+		return readAttribute(mbean, attributes[0], path)
+	}
+
+	return readAttributes(mbean, attributes, path, false, req.ignoreErrors())
+}
+
+// readAttributes returns the values of the attributes by name, all attributes if none
+// are given. Attributes that can't be read are skipped or have their error as value.
+func readAttributes(mbean *MBean, attributes []string, path []string, skip, ignore bool) (map[string]interface{}, error) {
+	if len(attributes) == 0 {
+		for name := range mbean.Attributes {
+			attributes = append(attributes, name)
+		}
+	}
+
+	values := make(map[string]interface{}, len(attributes))
+	for _, name := range attributes {
+		value, err := readAttribute(mbean, name, path)
+		switch {
+		case err == nil:
+			values[name] = value
+		case ignore:
+			values[name] = "ERROR: " + err.Error()
+		case !skip:
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+func readAttribute(mbean *MBean, attribute string, path []string) (interface{}, error) {
+	value, ok := mbean.Attributes[attribute]
+	if !ok {
+		return nil, attributeNotFound("no attribute %s for mbean %s", attribute, mbean.Name)
+	}
+
+	value, err := walk(value, path)
+	if err != nil {
+		return nil, attributeNotFound("%v of attribute %s of mbean %s", err, attribute, mbean.Name)
+	}
+
+	return value, nil
+}
+
+// attributes returns the requested attribute names and whether a single attribute was
+// requested instead of a list
+func (req request) attributes() ([]string, bool, error) {
+	switch attribute := req.Attribute.(type) {
+	case nil:
+		return nil, false, nil
+	case string:
+		if attribute == "" {
+			return nil, false, nil
+		}
+		return []string{attribute}, true, nil
+	case []interface{}:
+		attributes := make([]string, 0, len(attribute))
+		for _, a := range attribute {
+			name, ok := a.(string)
+			if !ok {
+				return nil, false, badRequest("invalid attribute %v", a)
+			}
+			attributes = append(attributes, name)
+		}
+		return attributes, false, nil
+	default:
+		return nil, false, badRequest("invalid attribute %v", attribute)
+	}
+}
+
+// list returns the meta data of all MBeans as a tree of domain, key properties and their
+// attributes and operations, narrowed down by the request path
+func (a *Agent) list(req request) (interface{}, error) {
+	a.Registry.mutex.RLock()
+	defer a.Registry.mutex.RUnlock()
+
+	tree := make(map[string]interface{})
+	for name, mbean := range a.Registry.mbeans {
+		parts := strings.SplitN(name, ":", 2)
+
+		domain, ok := tree[parts[0]].(map[string]interface{})
+		if !ok {
+			domain = make(map[string]interface{})
+			tree[parts[0]] = domain
+		}
+
+		attributes := make(map[string]interface{}, len(mbean.Attributes))
+		for attribute, value := range mbean.Attributes {
+			attributes[attribute] = map[string]interface{}{
+				"type": typeName(value),
+				"desc": attribute,
+				"rw":   true,
+			}
+		}
+
+		operations := make(map[string]interface{}, len(mbean.Operations))
+		for operation := range mbean.Operations {
+			operations[operation] = map[string]interface{}{
+				"args": []interface{}{},
+				"ret":  "java.lang.Object",
+				"desc": operation,
+			}
+		}
+
+		domain[parts[1]] = map[string]interface{}{
+			"desc": mbean.Name,
+			"attr": attributes,
+			"op":   operations,
+		}
+	}
+
+	value, err := walk(tree, splitPath(req.Path))
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+
+	return value, nil
+}
+
+// search returns the names of the MBeans matching the pattern
+func (a *Agent) search(req request) (interface{}, error) {
+	mbeans, err := a.Registry.match(req.MBean)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+
+	names := make([]string, 0, len(mbeans))
+	for _, mbean := range mbeans {
+		names = append(names, mbean.Name)
+	}
+
+	return names, nil
+}
+
+// exec calls an operation of a MBean, a signature like op(java.lang.String) is ignored
+func (a *Agent) exec(req request) (interface{}, error) {
+	operation := req.Operation
+	if i := strings.Index(operation, "("); i >= 0 {
+		operation = operation[:i]
+	}
+
+	a.Registry.mutex.RLock()
+	mbean, err := a.Registry.lookup(req.MBean)
+	var op Operation
+	if err == nil {
+		op = mbean.Operations[operation]
+	}
+	a.Registry.mutex.RUnlock()
+
+	if err != nil {
+		return nil, instanceNotFound(req.MBean)
+	}
+	if op == nil {
+		return nil, badRequest("no operation %s found on mbean %s", req.Operation, req.MBean)
+	}
+
+	return op(req.Arguments)
+}
+
+// walk returns the value at the path inside of nested maps and lists
+func walk(value interface{}, path []string) (interface{}, error) {
+	for i, segment := range path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[segment]
+			if !ok {
+				return nil, fmt.Errorf("no value at path %s", strings.Join(path[:i+1], "/"))
+			}
+			value = next
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, fmt.Errorf("no value at path %s", strings.Join(path[:i+1], "/"))
+			}
+			value = v[index]
+		default:
+			return nil, fmt.Errorf("no value at path %s", strings.Join(path[:i+1], "/"))
+		}
+	}
+
+	return value, nil
+}
+
+// splitPath splits a Jolokia path at slashes, !/ escapes a slash and !! an exclamation mark
+func splitPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+
+	segments := make([]string, 0)
+	segment := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '!' && i+1 < len(path):
+			i++
+			segment = append(segment, path[i])
+		case path[i] == '/':
+			segments = append(segments, string(segment))
+			segment = segment[:0]
+		default:
+			segment = append(segment, path[i])
+		}
+	}
+
+	return append(segments, string(segment))
+}
+
+// joinPath joins path segments, escaping slashes and exclamation marks
+func joinPath(segments []string) string {
+	escaped := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		segment = strings.Replace(segment, "!", "!!", -1)
+		escaped = append(escaped, strings.Replace(segment, "/", "!/", -1))
+	}
+
+	return strings.Join(escaped, "/")
+}
+
+// parseURL parses a GET request like /read/java.lang:type=Memory/HeapMemoryUsage/used
+func parseURL(path string) (request, error) {
+	segments := splitPath(strings.Trim(path, "/"))
+	if len(segments) == 0 {
+		return request{Type: "version"}, nil
+	}
+
+	req := request{Type: segments[0]}
+	args := segments[1:]
+
+	switch req.Type {
+	case "read":
+		if len(args) == 0 {
+			return req, badRequest("no mbean given")
+		}
+		req.MBean = args[0]
+		if len(args) > 1 {
+			req.Attribute = args[1]
+		}
+		if len(args) > 2 {
+			req.Path = joinPath(args[2:])
+		}
+	case "list":
+		req.Path = joinPath(args)
+	case "search":
+		if len(args) == 0 {
+			return req, badRequest("no mbean pattern given")
+		}
+		req.MBean = args[0]
+	case "exec":
+		if len(args) < 2 {
+			return req, badRequest("no mbean and operation given")
+		}
+		req.MBean = args[0]
+		req.Operation = args[1]
+		for _, arg := range args[2:] {
+			req.Arguments = append(req.Arguments, arg)
+		}
+	case "version":
+	default:
+		return req, badRequest("unknown request type %q", req.Type)
+	}
+
+	return req, nil
+}
+
+// typeName returns the Java type of an attribute value for list responses
+func typeName(value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		return "boolean"
+	case string:
+		return "java.lang.String"
+	case int, int32, int64:
+		return "long"
+	case float32, float64:
+		return "double"
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			return "double"
+		}
+		return "long"
+	case map[string]interface{}:
+		return "javax.management.openmbean.CompositeData"
+	case []interface{}:
+		return "[Ljava.lang.Object;"
+	default:
+		return "java.lang.Object"
+	}
+}
@@ -0,0 +1,302 @@
+package jolokiatest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRegistry(t *testing.T) *Registry {
+	r := NewRegistry()
+
+	mbeans := map[string]map[string]interface{}{
+		"java.lang:type=Memory": {
+			"HeapMemoryUsage": map[string]interface{}{"used": 100.0, "max": 400.0},
+		},
+		"java.lang:type=GarbageCollector,name=G1 Young Generation": {
+			"CollectionCount": 12.0,
+			"LastGcInfo":      map[string]interface{}{"a/b": 1.0},
+		},
+		"java.lang:type=GarbageCollector,name=G1 Old Generation": {
+			"CollectionCount": 1.0,
+		},
+	}
+
+	for name, attributes := range mbeans {
+		if _, err := r.Register(name, attributes); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := r.AddOperation("java.lang:type=Memory", "add", func(args []interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, errors.New("expected two arguments")
+		}
+
+		a, ok := args[0].(float64)
+		b, ok2 := args[1].(float64)
+		if !ok || !ok2 {
+			return nil, errors.New("expected numeric arguments")
+		}
+		return a + b, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func post(t *testing.T, url, body string) []map[string]interface{} {
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var responses []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&responses); err != nil {
+		t.Fatalf("Error decoding bulk response: %v", err)
+	}
+
+	return responses
+}
+
+func get(t *testing.T, url string) map[string]interface{} {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	return response
+}
+
+func TestAgent_BulkRead(t *testing.T) {
+	srv := httptest.NewServer(NewAgent(newTestRegistry(t)))
+	defer srv.Close()
+
+	responses := post(t, srv.URL, `[
+		{"type": "read", "mbean": "java.lang:type=Memory", "attribute": "HeapMemoryUsage", "path": "used"},
+		{"type": "read", "mbean": "java.lang:type=Memory"},
+		{"type": "read", "mbean": "java.lang:type=GarbageCollector,name=*", "attribute": "CollectionCount"},
+		{"type": "read", "mbean": "java.lang:type=GarbageCollector,name=G1 Young Generation", "attribute": "LastGcInfo", "path": "a!/b"},
+		{"type": "read", "mbean": "java.lang:type=Threading"},
+		{"type": "read", "mbean": "java.lang:type=Memory", "attribute": "NonHeapMemoryUsage"}
+	]`)
+
+	if len(responses) != 6 {
+		t.Fatalf("Expected 6 responses, got %d", len(responses))
+	}
+
+	expected := []interface{}{
+		100.0,
+		map[string]interface{}{"HeapMemoryUsage": map[string]interface{}{"used": 100.0, "max": 400.0}},
+		map[string]interface{}{
+			"java.lang:name=G1 Old Generation,type=GarbageCollector":   map[string]interface{}{"CollectionCount": 1.0},
+			"java.lang:name=G1 Young Generation,type=GarbageCollector": map[string]interface{}{"CollectionCount": 12.0},
+		},
+		1.0,
+	}
+
+	for i, value := range expected {
+		if responses[i]["status"] != 200.0 {
+			t.Errorf("Expected status 200 for request %d, got %v: %v", i, responses[i]["status"], responses[i]["error"])
+		}
+		if !reflect.DeepEqual(responses[i]["value"], value) {
+			t.Errorf("Expected value %v for request %d, got %v", value, i, responses[i]["value"])
+		}
+	}
+
+	if request := responses[0]["request"].(map[string]interface{}); request["path"] != "used" {
+		t.Errorf("Expected the request to be echoed, got %v", request)
+	}
+
+	for i, errorType := range map[int]string{4: "javax.management.InstanceNotFoundException", 5: "javax.management.AttributeNotFoundException"} {
+		if responses[i]["status"] != 404.0 || responses[i]["error_type"] != errorType {
+			t.Errorf("Expected status 404 with %s for request %d, got %v", errorType, i, responses[i])
+		}
+	}
+}
+
+func TestAgent_Get(t *testing.T) {
+	srv := httptest.NewServer(NewAgent(newTestRegistry(t)))
+	defer srv.Close()
+
+	tests := []struct {
+		url   string
+		value interface{}
+	}{
+		{"/read/java.lang:type=Memory/HeapMemoryUsage/max", 400.0},
+		{"/search/java.lang:type=GarbageCollector,*", []interface{}{
+			"java.lang:name=G1 Old Generation,type=GarbageCollector",
+			"java.lang:name=G1 Young Generation,type=GarbageCollector",
+		}},
+		{"/search/jboss.as:*", []interface{}{}},
+		{"/exec/java.lang:type=Memory/add(double,double)/1/2", nil},
+		{"/list/java.lang/type=Memory/attr/HeapMemoryUsage/type", "javax.management.openmbean.CompositeData"},
+		{"/version/", map[string]interface{}{
+			"agent":    AgentVersion,
+			"protocol": ProtocolVersion,
+			"config":   map[string]interface{}{},
+			"info":     map[string]interface{}{"product": "jolokiatest", "vendor": "scalify"},
+		}},
+	}
+
+	for _, test := range tests {
+		response := get(t, srv.URL+test.url)
+		if test.value == nil {
+			// exec arguments of GET requests are strings, the operation fails on them
+			if response["status"] != 500.0 {
+				t.Errorf("Expected status 500 for %s, got %v", test.url, response)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(response["value"], test.value) {
+			t.Errorf("Expected value %v for %s, got %v", test.value, test.url, response)
+		}
+	}
+}
+
+func TestAgent_Exec(t *testing.T) {
+	srv := httptest.NewServer(NewAgent(newTestRegistry(t)))
+	defer srv.Close()
+
+	responses := post(t, srv.URL, `[
+		{"type": "exec", "mbean": "java.lang:type=Memory", "operation": "add", "arguments": [1, 2]},
+		{"type": "exec", "mbean": "java.lang:type=Memory", "operation": "gc"}
+	]`)
+
+	if responses[0]["value"] != 3.0 {
+		t.Errorf("Expected exec to return 3, got %v", responses[0])
+	}
+	if responses[1]["status"] != 400.0 {
+		t.Errorf("Expected status 400 for an unknown operation, got %v", responses[1])
+	}
+}
+
+func TestAgent_FaultInjection(t *testing.T) {
+	agent := NewAgent(newTestRegistry(t))
+	srv := httptest.NewServer(agent)
+	defer srv.Close()
+
+	agent.FailRequests(2, http.StatusInternalServerError)
+
+	for i, status := range []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK} {
+		resp, err := http.Get(srv.URL + "/version")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != status {
+			t.Errorf("Expected status %d for request %d, got %d", status, i, resp.StatusCode)
+		}
+	}
+
+	if agent.Requests() != 3 {
+		t.Errorf("Expected 3 requests, got %d", agent.Requests())
+	}
+
+	agent.SetLatency(50 * time.Millisecond)
+	start := time.Now()
+	get(t, srv.URL+"/version")
+	if time.Since(start) < 50*time.Millisecond {
+		t.Errorf("Expected the response to be delayed")
+	}
+
+	agent.Registry.Unregister("java.lang:type=Memory")
+	if response := get(t, srv.URL+"/read/java.lang:type=Memory"); response["status"] != 404.0 {
+		t.Errorf("Expected status 404 for an unregistered mbean, got %v", response)
+	}
+}
+
+func TestAgent_Auth(t *testing.T) {
+	agent := NewAgent(newTestRegistry(t))
+	agent.Auth = BasicAuth("admin", "secret")
+	srv := httptest.NewServer(agent)
+	defer srv.Close()
+
+	tests := []struct {
+		user, password string
+		status         int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"admin", "wrong", http.StatusUnauthorized},
+		{"admin", "secret", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/version", nil)
+		if test.user != "" {
+			req.SetBasicAuth(test.user, test.password)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("Expected status %d for user %q, got %d", test.status, test.user, resp.StatusCode)
+		}
+	}
+}
+
+func TestObjectName_Matches(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		matches       bool
+	}{
+		{"java.lang:type=Memory", "java.lang:type=Memory", true},
+		{"java.lang:type=Memory", "java.lang:type=Memory,name=x", false},
+		{"java.lang:type=Memory,*", "java.lang:name=x,type=Memory", true},
+		{"java.lang:type=GarbageCollector,name=G1*", "java.lang:name=G1 Old Generation,type=GarbageCollector", true},
+		{"java.lang:type=GarbageCollector,name=PS?", "java.lang:name=PS Scavenge,type=GarbageCollector", false},
+		{"java.*:type=Memory", "java.nio:type=Memory", true},
+		{"*:*", "jboss.as:subsystem=datasources", true},
+	}
+
+	for _, test := range tests {
+		p, err := parseObjectName(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := parseObjectName(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p.matches(n) != test.matches {
+			t.Errorf("Expected %s matching %s to be %v", test.pattern, test.name, test.matches)
+		}
+	}
+}
+
+func TestLoadRegistry(t *testing.T) {
+	r, err := LoadRegistry("../fixtures/mbeans.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mbeans, err := r.match("java.lang:type=Threading")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mbeans) != 1 || mbeans[0].Attributes["ThreadCount"] != json.Number("421") {
+		t.Errorf("Expected the thread count to be loaded, got %v", mbeans)
+	}
+}
@@ -0,0 +1,36 @@
+package jolokiatest
+
+import (
+	"errors"
+	"net/http"
+)
+
+// AuthPolicy authenticates the requests of an Agent. Requests failing authentication are
+// answered with 401 Unauthorized and the error message.
+type AuthPolicy interface {
+	Authenticate(r *http.Request) error
+}
+
+// AuthFunc adapts a function to an AuthPolicy
+type AuthFunc func(r *http.Request) error
+
+// Authenticate calls f(r)
+func (f AuthFunc) Authenticate(r *http.Request) error {
+	return f(r)
+}
+
+// BasicAuth returns an AuthPolicy accepting requests with the given basic auth credentials
+func BasicAuth(username, password string) AuthPolicy {
+	return AuthFunc(func(r *http.Request) error {
+		u, p, ok := r.BasicAuth()
+		if !ok {
+			return errors.New("Unauthorized")
+		}
+
+		if u != username || p != password {
+			return errors.New("Wrong credentials")
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,276 @@
+package jolokiatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Operation is an operation of a MBean, called with the arguments of an exec request
+type Operation func(args []interface{}) (interface{}, error)
+
+// MBean is a registered MBean with its attributes and operations
+type MBean struct {
+	Name       string
+	Attributes map[string]interface{}
+	Operations map[string]Operation
+}
+
+// Registry is an in-memory MBean server. It's safe for concurrent use, so MBeans can be
+// registered, changed or removed while an Agent is serving requests.
+type Registry struct {
+	mutex  sync.RWMutex
+	mbeans map[string]*MBean
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{mbeans: make(map[string]*MBean)}
+}
+
+// LoadRegistry reads a JSON file mapping MBean names to their attributes, e.g.
+// {"java.lang:type=Threading": {"ThreadCount": 421}}, into a new Registry.
+func LoadRegistry(file string) (*Registry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mbeans map[string]map[string]interface{}
+	decoder := json.NewDecoder(f)
+	decoder.UseNumber()
+	if err := decoder.Decode(&mbeans); err != nil {
+		return nil, fmt.Errorf("error decoding %s: %v", file, err)
+	}
+
+	r := NewRegistry()
+	for name, attributes := range mbeans {
+		if _, err := r.Register(name, attributes); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Register adds a MBean with the given attributes, replacing an existing MBean of the
+// same name. The name may list its key properties in any order.
+func (r *Registry) Register(name string, attributes map[string]interface{}) (*MBean, error) {
+	canonical, err := canonicalName(name)
+	if err != nil {
+		return nil, err
+	}
+	if isPattern(canonical) {
+		return nil, fmt.Errorf("can't register mbean pattern %q", name)
+	}
+
+	if attributes == nil {
+		attributes = make(map[string]interface{})
+	}
+
+	mbean := &MBean{
+		Name:       canonical,
+		Attributes: attributes,
+		Operations: make(map[string]Operation),
+	}
+
+	r.mutex.Lock()
+	r.mbeans[canonical] = mbean
+	r.mutex.Unlock()
+
+	return mbean, nil
+}
+
+// Unregister removes a MBean, requests for it fail with status 404 afterwards
+func (r *Registry) Unregister(name string) {
+	canonical, err := canonicalName(name)
+	if err != nil {
+		return
+	}
+
+	r.mutex.Lock()
+	delete(r.mbeans, canonical)
+	r.mutex.Unlock()
+}
+
+// SetAttribute sets the value of an attribute of a registered MBean
+func (r *Registry) SetAttribute(name, attribute string, value interface{}) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	mbean, err := r.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	mbean.Attributes[attribute] = value
+	return nil
+}
+
+// AddOperation adds an operation to a registered MBean
+func (r *Registry) AddOperation(name, operation string, op Operation) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	mbean, err := r.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	mbean.Operations[operation] = op
+	return nil
+}
+
+// lookup returns the MBean of the given name, the caller has to hold the mutex
+func (r *Registry) lookup(name string) (*MBean, error) {
+	canonical, err := canonicalName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	mbean, ok := r.mbeans[canonical]
+	if !ok {
+		return nil, fmt.Errorf("no mbean %s registered", name)
+	}
+
+	return mbean, nil
+}
+
+// match returns the MBeans matching the name or pattern, sorted by name
+func (r *Registry) match(pattern string) ([]*MBean, error) {
+	p, err := parseObjectName(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	mbeans := make([]*MBean, 0)
+	for name, mbean := range r.mbeans {
+		n, _ := parseObjectName(name)
+		if p.matches(n) {
+			mbeans = append(mbeans, mbean)
+		}
+	}
+
+	sort.Slice(mbeans, func(i, j int) bool {
+		return mbeans[i].Name < mbeans[j].Name
+	})
+
+	return mbeans, nil
+}
+
+// objectName is a parsed JMX ObjectName. Property values and the domain of patterns may
+// contain the wildcards * and ?, a trailing * in the property list matches any further
+// properties.
+type objectName struct {
+	domain     string
+	properties map[string]string
+	wildcard   bool
+}
+
+func parseObjectName(name string) (objectName, error) {
+	parts := strings.SplitN(name, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return objectName{}, fmt.Errorf("invalid object name %q", name)
+	}
+
+	n := objectName{domain: parts[0], properties: make(map[string]string)}
+	for _, property := range strings.Split(parts[1], ",") {
+		if property == "*" {
+			n.wildcard = true
+			continue
+		}
+
+		kv := strings.SplitN(property, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return objectName{}, fmt.Errorf("invalid key property %q of object name %q", property, name)
+		}
+		n.properties[kv[0]] = kv[1]
+	}
+
+	return n, nil
+}
+
+// String returns the canonical name with the key properties sorted by key
+func (n objectName) String() string {
+	keys := make([]string, 0, len(n.properties))
+	for key := range n.properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	properties := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		properties = append(properties, key+"="+n.properties[key])
+	}
+	if n.wildcard {
+		properties = append(properties, "*")
+	}
+
+	return n.domain + ":" + strings.Join(properties, ",")
+}
+
+func (n objectName) matches(other objectName) bool {
+	if !glob(n.domain, other.domain) {
+		return false
+	}
+
+	if !n.wildcard && len(n.properties) != len(other.properties) {
+		return false
+	}
+
+	for key, value := range n.properties {
+		otherValue, ok := other.properties[key]
+		if !ok || !glob(value, otherValue) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func canonicalName(name string) (string, error) {
+	n, err := parseObjectName(name)
+	if err != nil {
+		return "", err
+	}
+
+	return n.String(), nil
+}
+
+func isPattern(name string) bool {
+	return strings.ContainsAny(name, "*?")
+}
+
+// glob matches s against a pattern where * matches any sequence and ? any single character
+func glob(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if glob(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+		}
+
+		pattern, s = pattern[1:], s[1:]
+	}
+
+	return len(s) == 0
+}
@@ -0,0 +1,93 @@
+package jolokia
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// limitSeries drops the series of mappings over their MaxSeries and the series of the
+// target over maxSeries, the limit of all mappings. Within a mapping the series are kept
+// ordered by name and labels, the global limit keeps the series of earlier mappings, so
+// the same series are kept on every scrape as long as they exist. The number of dropped
+// series is returned by mapping target.
+func limitSeries(samples []Sample, maxSeries int) ([]Sample, map[string]int) {
+	dropped := make(map[string]int)
+
+	// indices of the samples of each mapping, in the order of the mappings
+	var sources []MetricSource
+	groups := make(map[MetricSource][]int)
+	for i, s := range samples {
+		var source MetricSource
+		if s.Mapping != nil {
+			source = s.Mapping.Source
+		}
+
+		if _, ok := groups[source]; !ok {
+			sources = append(sources, source)
+		}
+		groups[source] = append(groups[source], i)
+	}
+
+	kept := make([]bool, len(samples))
+	budget := maxSeries
+	for _, source := range sources {
+		indices := groups[source]
+		mapping := samples[indices[0]].Mapping
+
+		limit := len(indices)
+		if mapping != nil && mapping.MaxSeries > 0 && mapping.MaxSeries < limit {
+			limit = mapping.MaxSeries
+		}
+		if maxSeries > 0 && budget < limit {
+			limit = budget
+		}
+		budget -= limit
+
+		if limit < len(indices) {
+			sort.SliceStable(indices, func(a, b int) bool {
+				return seriesName(samples[indices[a]].Name, samples[indices[a]].Labels) < seriesName(samples[indices[b]].Name, samples[indices[b]].Labels)
+			})
+
+			target := ""
+			if mapping != nil {
+				target = mapping.Target
+			}
+			dropped[target] += len(indices) - limit
+		}
+
+		for _, i := range indices[:limit] {
+			kept[i] = true
+		}
+	}
+
+	if len(dropped) == 0 {
+		return samples, dropped
+	}
+
+	result := make([]Sample, 0, len(samples))
+	for i, s := range samples {
+		if kept[i] {
+			result = append(result, s)
+		}
+	}
+
+	return result, dropped
+}
+
+// droppedSeriesMessage summarizes the dropped series of a scrape, like
+// "12 series of mapping gc, 3 series of mapping threads"
+func droppedSeriesMessage(dropped map[string]int) string {
+	targets := make([]string, 0, len(dropped))
+	for target := range dropped {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	parts := make([]string, 0, len(targets))
+	for _, target := range targets {
+		parts = append(parts, fmt.Sprintf("%d series of mapping %s", dropped[target], target))
+	}
+
+	return strings.Join(parts, ", ")
+}
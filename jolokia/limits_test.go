@@ -0,0 +1,121 @@
+package jolokia
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestLimitSeries(t *testing.T) {
+	gc := &MetricMapping{Source: MetricSource{Mbean: "java.lang:type=GarbageCollector,name=*"}, Target: "gc", MaxSeries: 2}
+	threads := &MetricMapping{Source: MetricSource{Mbean: "java.lang:type=Threading"}, Target: "threads"}
+
+	samples := []Sample{
+		{Name: "gc_young_count", Mapping: gc},
+		{Name: "threads_count", Mapping: threads},
+		{Name: "gc_old_time", Mapping: gc},
+		{Name: "gc_old_count", Mapping: gc},
+		{Name: "threads_daemon_count", Mapping: threads},
+		{Name: "threads_peak_count", Mapping: threads},
+	}
+
+	tests := []struct {
+		maxSeries int
+		expected  []string
+		dropped   map[string]int
+	}{
+		{0, []string{"threads_count", "gc_old_time", "gc_old_count", "threads_daemon_count", "threads_peak_count"}, map[string]int{"gc": 1}},
+		{4, []string{"threads_count", "gc_old_time", "gc_old_count", "threads_daemon_count"}, map[string]int{"gc": 1, "threads": 1}},
+		{1, []string{"gc_old_count"}, map[string]int{"gc": 2, "threads": 3}},
+	}
+
+	for _, test := range tests {
+		result, dropped := limitSeries(samples, test.maxSeries)
+
+		names := make([]string, 0, len(result))
+		for _, s := range result {
+			names = append(names, s.Name)
+		}
+
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("Expected series %v with a limit of %d, got %v", test.expected, test.maxSeries, names)
+		}
+		if !reflect.DeepEqual(dropped, test.dropped) {
+			t.Errorf("Expected dropped series %v with a limit of %d, got %v", test.dropped, test.maxSeries, dropped)
+		}
+	}
+
+	if droppedSeriesMessage(map[string]int{"threads": 3, "gc": 2}) != "2 series of mapping gc, 3 series of mapping threads" {
+		t.Errorf("Unexpected message %q", droppedSeriesMessage(map[string]int{"threads": 3, "gc": 2}))
+	}
+}
+
+func TestClient_ScrapeMaxSeries(t *testing.T) {
+	srv := httptest.NewServer(newTestAgent(nil))
+	defer srv.Close()
+
+	config := &Config{
+		MaxSeries: 3,
+		Metrics: []MetricMapping{
+			{Source: MetricSource{Mbean: "java.lang:type=GarbageCollector,name=*", Attribute: "CollectionCount"}, Target: "gc", MaxSeries: 1},
+			{Source: MetricSource{Mbean: "java.lang:type=OperatingSystem"}, Target: "os"},
+		},
+	}
+
+	client, err := NewClient(ClientOptions{Config: config, Namespace: Namespace, Target: TargetConfig{URL: srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		result, err := client.Scrape(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result.Samples) != 3 {
+			t.Fatalf("Expected 3 series, got %d", len(result.Samples))
+		}
+		if result.Samples[0].Mapping.Target != "gc" {
+			t.Errorf("Expected the series of the first mapping to be kept, got %s", result.Samples[0].Name)
+		}
+
+		for mapping, expected := range map[string]float64{"gc": 1, "os": 10} {
+			metric := &dto.Metric{}
+			if err := client.stats.seriesDropped.WithLabelValues(mapping).Write(metric); err != nil {
+				t.Fatal(err)
+			}
+			if metric.Counter.GetValue() != expected*float64(i) {
+				t.Errorf("Expected %v dropped series of mapping %s, got %v", expected*float64(i), mapping, metric.Counter.GetValue())
+			}
+		}
+	}
+}
+
+func TestConfigValidateMaxSeries(t *testing.T) {
+	config := &Config{
+		MaxSeries: -1,
+		Metrics: []MetricMapping{
+			{Source: MetricSource{Mbean: "java.lang:type=Threading", Attribute: "ThreadCount"}, Target: "threads", MaxSeries: -1},
+		},
+	}
+
+	errs, ok := config.Validate().(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected validation errors, got %v", config.Validate())
+	}
+
+	expected := []string{"maxSeries", "metrics[0].maxSeries"}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %v", len(expected), errs)
+	}
+
+	for i, path := range expected {
+		if errs[i].Path != path {
+			t.Errorf("Expected an error of %s, got %v", path, errs[i])
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package jolokia
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxCachedNames limits the number of names cached by a client, so mbean patterns matching
+// ever new mbeans don't grow the cache forever. The cache is cleared once it's full.
+const maxCachedNames = 100000
+
+// nameCache caches the sanitized names and the descriptors of flattened values by the
+// target of their mapping and the raw keys leading to them, so steady-state scrapes don't
+// sanitize the same keys and build the same descriptors again. A cache belongs to a
+// client and is built for its mappings, namespace and labels, a client created for a
+// reloaded config starts with an empty cache.
+type nameCache struct {
+	namespace string
+	labels    map[string]string
+
+	mutex sync.Mutex
+	roots map[string]*nameNode
+	size  int
+}
+
+// nameNode holds the name of a key path, its children are the paths one key longer
+type nameNode struct {
+	name     string
+	fqName   string
+	desc     *prometheus.Desc
+	children map[string]*nameNode
+}
+
+func newNameCache(namespace string, labels map[string]string) *nameCache {
+	return &nameCache{
+		namespace: namespace,
+		labels:    labels,
+		roots:     make(map[string]*nameNode),
+	}
+}
+
+// lookup returns the node of the keys below the target, the names of keys that weren't
+// seen before are sanitized and added. The caller has to hold the mutex.
+func (c *nameCache) lookup(target string, keys []string) *nameNode {
+	node, ok := c.roots[target]
+	if !ok {
+		node = c.newNode(target)
+		c.roots[target] = node
+	}
+
+	for _, key := range keys {
+		child, ok := node.children[key]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[string]*nameNode)
+			}
+
+			child = c.newNode(sanitize(strings.Join([]string{node.name, key}, "_")))
+			node.children[key] = child
+		}
+
+		node = child
+	}
+
+	return node
+}
+
+func (c *nameCache) newNode(name string) *nameNode {
+	c.size++
+	return &nameNode{name: name, fqName: prometheus.BuildFQName(c.namespace, "", name)}
+}
+
+// descriptor returns the descriptor of the samples of the node, the caller has to hold
+// the mutex of the cache
+func (c *nameCache) descriptor(node *nameNode) *prometheus.Desc {
+	if node.desc == nil {
+		node.desc = prometheus.NewDesc(node.fqName, node.name, nil, c.labels)
+	}
+
+	return node.desc
+}
+
+// flatValues names the values of a response to a mapping, the keys of nested values are
+// joined to the target with an underscore. The response to an mbean pattern contains the
+// values of all matching mbeans by name, so the first key tells the mbean of a value.
+func (c *nameCache) flatValues(mapping MetricMapping, values []keyedValue) []flatValue {
+	pattern := isMbeanPattern(mapping.Source.Mbean)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.size > maxCachedNames {
+		c.roots = make(map[string]*nameNode)
+		c.size = 0
+	}
+
+	result := make([]flatValue, 0, len(values))
+	for _, v := range values {
+		node := c.lookup(mapping.Target, v.keys)
+
+		mbean := mapping.Source.Mbean
+		if pattern && len(v.keys) > 0 {
+			mbean = v.keys[0]
+		}
+
+		result = append(result, flatValue{
+			name:   node.name,
+			fqName: node.fqName,
+			desc:   c.descriptor(node),
+			mbean:  mbean,
+			value:  v.value,
+		})
+	}
+
+	return result
+}
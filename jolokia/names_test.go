@@ -0,0 +1,111 @@
+package jolokia
+
+import (
+	"testing"
+)
+
+func TestNameCache_FlatValues(t *testing.T) {
+	names := newNameCache(Namespace, map[string]string{"env": "test"})
+	mapping := MetricMapping{Source: MetricSource{Mbean: "java.lang:name=*,type=GarbageCollector"}, Target: "java_gc"}
+	values := []keyedValue{
+		{keys: []string{"java.lang:name=G1 Old Generation,type=GarbageCollector", "CollectionCount"}, value: 1},
+		{keys: []string{"java.lang:name=G1 Old Generation,type=GarbageCollector", "CollectionTime"}, value: 2},
+	}
+
+	first := names.flatValues(mapping, values)
+	second := names.flatValues(mapping, values)
+
+	expected := []string{
+		"java_gc_java_lang_name_g_1_old_generation_type_garbage_collector_collection_count",
+		"java_gc_java_lang_name_g_1_old_generation_type_garbage_collector_collection_time",
+	}
+
+	for i, name := range expected {
+		if first[i].name != name || first[i].fqName != "jolokia_"+name {
+			t.Errorf("Expected name %s, got %s (%s)", name, first[i].name, first[i].fqName)
+		}
+		if first[i].mbean != "java.lang:name=G1 Old Generation,type=GarbageCollector" {
+			t.Errorf("Expected the mbean of the value, got %s", first[i].mbean)
+		}
+		if second[i].desc != first[i].desc {
+			t.Errorf("Expected the descriptor of %s to be cached", name)
+		}
+	}
+
+	// target, mbean and both attributes
+	if names.size != 4 {
+		t.Errorf("Expected 4 cached names, got %d", names.size)
+	}
+
+	names.size = maxCachedNames + 1
+	if third := names.flatValues(mapping, values); third[0].desc == first[0].desc {
+		t.Error("Expected a full cache to be cleared")
+	}
+	if names.size != 4 {
+		t.Errorf("Expected the cleared cache to be refilled with 4 names, got %d", names.size)
+	}
+}
+
+func TestSample_MetricRenamed(t *testing.T) {
+	names := newNameCache(Namespace, nil)
+	v := names.flatValues(MetricMapping{Target: "java_threads"}, []keyedValue{{value: 1}})[0]
+
+	s := Sample{Name: v.fqName, Help: v.name}
+	s.setDesc(v.desc)
+
+	if s.Metric().Desc() != v.desc {
+		t.Error("Expected the cached descriptor to be used")
+	}
+
+	s.Name = s.Name + "_2"
+	if s.Metric().Desc() == v.desc {
+		t.Error("Expected a renamed sample not to use the cached descriptor")
+	}
+}
+
+// BenchmarkScrapeResponse measures a scrape of a large wildcard response including the
+// prometheus metrics of its samples, on a new client and in the steady state of a client
+// that scraped the same mbeans before
+func BenchmarkScrapeResponse(b *testing.B) {
+	body, mappings := wildcardResponse(500, 20)
+
+	config := &Config{}
+	for _, m := range mappings {
+		config.Metrics = append(config.Metrics, m)
+	}
+
+	client, err := NewClient(ClientOptions{Config: config, Namespace: Namespace, Labels: map[string]string{"target": "app-1"}})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	scrape := func(b *testing.B) {
+		result, err := client.ScrapeResponse(body)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for _, s := range result.Samples {
+			s.Metric()
+		}
+	}
+
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			client.names = newNameCache(Namespace, client.labels)
+			scrape(b)
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		scrape(b)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			scrape(b)
+		}
+	})
+}
@@ -0,0 +1,302 @@
+package jolokia
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/version"
+)
+
+const (
+	defaultOTLPTimeout = 10 * time.Second
+
+	otlpScopeName = "jolokia_exporter"
+
+	// endpointAttribute is the resource attribute holding the url of the jolokia endpoint
+	endpointAttribute = "jolokia.url"
+
+	// cumulative aggregation temporality of OTLP sums
+	otlpCumulative = 2
+)
+
+// OTLPWriter collects samples in an interval and pushes them to an OpenTelemetry collector
+// using OTLP/HTTP with JSON encoding. Every jolokia endpoint is reported as resource, the
+// labels of its target become resource attributes and the other labels of its samples
+// attributes of their data points. Counters are sent as monotonic cumulative sums, all
+// other samples as gauges.
+type OTLPWriter struct {
+	logger log.Logger
+	config OTLPConfig
+	source SampleSource
+
+	client            *http.Client
+	basicAuthUser     string
+	basicAuthPassword string
+}
+
+// NewOTLPWriter returns an OTLPWriter pushing the samples of the given source
+func NewOTLPWriter(logger log.Logger, config OTLPConfig, source SampleSource) (*OTLPWriter, error) {
+	client, err := newHTTPClient(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Timeout = defaultOTLPTimeout
+	if config.Timeout > 0 {
+		client.Timeout = time.Duration(config.Timeout)
+	}
+
+	user, password, err := config.BasicAuth.credentials()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read password file for %s: %v", config.URL, err)
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = Duration(defaultPushInterval)
+	}
+
+	return &OTLPWriter{
+		logger:            logger,
+		config:            config,
+		source:            source,
+		client:            client,
+		basicAuthUser:     user,
+		basicAuthPassword: password,
+	}, nil
+}
+
+// Run pushes the samples in the configured interval until stop is closed
+func (w *OTLPWriter) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(w.config.Interval))
+	defer ticker.Stop()
+
+	for {
+		if err := w.Push(); err != nil {
+			w.logger.Errorf("Error pushing samples to %s: %v", w.config.URL, err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Push collects the samples and sends them to the collector
+func (w *OTLPWriter) Push() error {
+	samples := w.source.Samples()
+	if len(samples) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(newOTLPRequest(samples, w.config.ResourceAttributes))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	for name, value := range w.config.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.basicAuthUser != "" || w.basicAuthPassword != "" {
+		req.SetBasicAuth(w.basicAuthUser, w.basicAuthPassword)
+	}
+
+	w.logger.Debugf("Pushing %d samples to %s", len(samples), w.config.URL)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+	return fmt.Errorf("server returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+}
+
+// The following types are the subset of the OTLP/JSON metrics request that is needed to
+// send gauges and sums, see opentelemetry-proto/opentelemetry/proto/metrics/v1.
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpAttribute struct {
+	Key   string             `json:"key"`
+	Value otlpAttributeValue `json:"value"`
+}
+
+type otlpAttributeValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpMetric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Gauge       *otlpGauge `json:"gauge,omitempty"`
+	Sum         *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsDouble     float64         `json:"asDouble"`
+}
+
+// newOTLPRequest groups the samples by endpoint and target labels into resources. The
+// given attributes are added to every resource unless the target has a label of that
+// name. The labels of a sample that aren't labels of its target identify its series
+// within the metric, they become the attributes of its data point.
+func newOTLPRequest(samples []Sample, attributes map[string]string) otlpRequest {
+	request := otlpRequest{ResourceMetrics: make([]otlpResourceMetrics, 0)}
+	resources := make(map[string]int)
+	metrics := make(map[string]map[string]int)
+
+	for _, s := range samples {
+		resourceAttributes := make(map[string]string, len(attributes)+len(s.TargetLabels)+1)
+		for name, value := range attributes {
+			resourceAttributes[name] = value
+		}
+		for name, value := range s.TargetLabels {
+			resourceAttributes[name] = value
+		}
+
+		pointAttributes := make(map[string]string)
+		for name, value := range s.Labels {
+			if target, ok := s.TargetLabels[name]; !ok || target != value {
+				pointAttributes[name] = value
+			}
+		}
+		if s.Endpoint != "" {
+			resourceAttributes[endpointAttribute] = s.Endpoint
+		}
+
+		resource := otlpResource{Attributes: newOTLPAttributes(resourceAttributes)}
+		key := resourceKey(resource)
+
+		r, ok := resources[key]
+		if !ok {
+			r = len(request.ResourceMetrics)
+			resources[key] = r
+			metrics[key] = make(map[string]int)
+			request.ResourceMetrics = append(request.ResourceMetrics, otlpResourceMetrics{
+				Resource: resource,
+				ScopeMetrics: []otlpScopeMetrics{{
+					Scope:   otlpScope{Name: otlpScopeName, Version: version.Version},
+					Metrics: make([]otlpMetric, 0),
+				}},
+			})
+		}
+
+		scope := &request.ResourceMetrics[r].ScopeMetrics[0]
+		point := otlpDataPoint{
+			Attributes:   newOTLPAttributes(pointAttributes),
+			TimeUnixNano: strconv.FormatInt(s.Timestamp.UnixNano(), 10),
+			AsDouble:     s.Value,
+		}
+
+		m, ok := metrics[key][s.Name]
+		if !ok {
+			m = len(scope.Metrics)
+			metrics[key][s.Name] = m
+			scope.Metrics = append(scope.Metrics, newOTLPMetric(s))
+		}
+
+		metric := &scope.Metrics[m]
+		if metric.Sum != nil {
+			metric.Sum.DataPoints = append(metric.Sum.DataPoints, point)
+		} else {
+			metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, point)
+		}
+	}
+
+	return request
+}
+
+// newOTLPAttributes returns the attributes sorted by name
+func newOTLPAttributes(attributes map[string]string) []otlpAttribute {
+	result := make([]otlpAttribute, 0, len(attributes))
+	for _, name := range sortedKeys(attributes) {
+		result = append(result, otlpAttribute{
+			Key:   name,
+			Value: otlpAttributeValue{StringValue: attributes[name]},
+		})
+	}
+
+	return result
+}
+
+// resourceKey identifies a resource by its sorted attributes
+func resourceKey(resource otlpResource) string {
+	parts := make([]string, 0, len(resource.Attributes))
+	for _, attribute := range resource.Attributes {
+		parts = append(parts, attribute.Key+"\xff"+attribute.Value.StringValue)
+	}
+
+	return strings.Join(parts, "\xfe")
+}
+
+func newOTLPMetric(s Sample) otlpMetric {
+	metric := otlpMetric{Name: s.Name, Description: s.Help}
+
+	if s.Type == prometheus.CounterValue {
+		metric.Sum = &otlpSum{
+			DataPoints:             make([]otlpDataPoint, 0, 1),
+			AggregationTemporality: otlpCumulative,
+			IsMonotonic:            true,
+		}
+	} else {
+		metric.Gauge = &otlpGauge{DataPoints: make([]otlpDataPoint, 0, 1)}
+	}
+
+	return metric
+}
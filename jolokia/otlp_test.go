@@ -0,0 +1,153 @@
+package jolokia
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/prometheus/common/log"
+)
+
+func TestOTLPWriter_Push(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(testHandler))
+	defer agent.Close()
+
+	requests := make([]otlpRequest, 0)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected request %s with content type %q", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		if r.Header.Get("X-Scope-OrgID") != "team-a" {
+			t.Errorf("Expected configured header to be sent, got %q", r.Header.Get("X-Scope-OrgID"))
+		}
+
+		request := otlpRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Error decoding request: %v", err)
+		}
+		requests = append(requests, request)
+	}))
+	defer collector.Close()
+
+	config := &Config{
+		Metrics: []MetricMapping{
+			{
+				Source: MetricSource{Mbean: "java.lang:type=Threading", Attribute: "ThreadCount"},
+				Target: "java_threading_thread_count",
+				Type:   MetricTypeGauge,
+			},
+			{
+				Source: MetricSource{Mbean: "java.lang:type=OperatingSystem"},
+				Target: "java_os",
+				Type:   MetricTypeCounter,
+			},
+			{
+				Source: MetricSource{Mbean: "java.lang:type=GarbageCollector,name=*", Attribute: "CollectionCount"},
+				Target: "jvm_gc_${value.attribute}",
+				Labels: map[string]string{"collector": "${mbean.name}"},
+			},
+		},
+	}
+
+	buf := bytes.NewBufferString("")
+	logger := log.NewLogger(buf)
+	logger.SetLevel("warn")
+
+	exp, err := NewTargetExporter(logger, config, Namespace, TargetConfig{
+		Name:   "app-1",
+		URL:    agent.URL,
+		Labels: map[string]string{"env": "test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err := NewOTLPWriter(logger, OTLPConfig{
+		URL:                collector.URL + "/v1/metrics",
+		Headers:            map[string]string{"X-Scope-OrgID": "team-a"},
+		ResourceAttributes: map[string]string{"service.name": "billing", "env": "prod"},
+	}, exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Push(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 1 || len(requests[0].ResourceMetrics) != 1 {
+		t.Fatalf("Expected a single request with a single resource, got %+v", requests)
+	}
+
+	resource := requests[0].ResourceMetrics[0]
+	expectedAttributes := otlpResource{Attributes: newOTLPAttributes(map[string]string{
+		"env":          "test",
+		"jolokia.url":  agent.URL,
+		"service.name": "billing",
+		"target":       "app-1",
+	})}
+	if !reflect.DeepEqual(resource.Resource, expectedAttributes) {
+		t.Errorf("Expected resource %+v, got %+v", expectedAttributes, resource.Resource)
+	}
+
+	metrics := make(map[string]otlpMetric)
+	for _, metric := range resource.ScopeMetrics[0].Metrics {
+		metrics[metric.Name] = metric
+	}
+
+	threads := metrics["jolokia_java_threading_thread_count"]
+	if threads.Gauge == nil || len(threads.Gauge.DataPoints) != 1 || threads.Gauge.DataPoints[0].AsDouble != 421 {
+		t.Errorf("Expected thread count to be a gauge of 421, got %+v", threads)
+	}
+
+	cpuTime := metrics["jolokia_java_os_process_cpu_time"]
+	if cpuTime.Sum == nil || !cpuTime.Sum.IsMonotonic || cpuTime.Sum.AggregationTemporality != otlpCumulative {
+		t.Errorf("Expected cpu time to be a monotonic cumulative sum, got %+v", cpuTime)
+	}
+
+	// series of a metric are told apart by the attributes of their data points
+	collections := metrics["jolokia_jvm_gc_collection_count"]
+	if collections.Gauge == nil || len(collections.Gauge.DataPoints) != 2 {
+		t.Fatalf("Expected two series of the gc collections under the resource, got %+v", collections)
+	}
+
+	collectors := make([]string, 0, 2)
+	for _, point := range collections.Gauge.DataPoints {
+		if len(point.Attributes) != 1 || point.Attributes[0].Key != "collector" {
+			t.Errorf("Expected the collector as attribute of the data point, got %+v", point.Attributes)
+			continue
+		}
+		collectors = append(collectors, point.Attributes[0].Value.StringValue)
+	}
+	sort.Strings(collectors)
+	if !reflect.DeepEqual(collectors, []string{"G1 Old Generation", "G1 Young Generation"}) {
+		t.Errorf("Expected a data point of every collector, got %v", collectors)
+	}
+
+	up := metrics["jolokia_up"]
+	if up.Gauge == nil || up.Gauge.DataPoints[0].AsDouble != 1 {
+		t.Errorf("Expected jolokia_up to be a gauge of 1, got %+v", up)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("unexpected otlp output: %v", buf.String())
+	}
+}
+
+func TestNewExporter_UnknownMetricType(t *testing.T) {
+	config := &Config{
+		Metrics: []MetricMapping{{
+			Source: MetricSource{Mbean: "java.lang:type=Threading", Attribute: "ThreadCount"},
+			Target: "java_threading_thread_count",
+			Type:   "histogram",
+		}},
+	}
+
+	if _, err := NewExporter(ClientOptions{Logger: log.Base(), Config: config, Namespace: Namespace, Target: TargetConfig{URL: "http://test/test"}}); err == nil {
+		t.Error("Expected an error for an unknown metric type")
+	}
+}
@@ -0,0 +1,178 @@
+package jolokia
+
+import (
+	"fmt"
+	"sort"
+)
+
+// presets are curated metric mappings for common jvm products, which can be enabled by
+// name instead of copying the mappings into every config
+var presets = map[string][]MetricMapping{
+	"jvm": {
+		presetMapping("java.lang:type=Memory", "HeapMemoryUsage", "jvm_memory_heap"),
+		presetMapping("java.lang:type=Memory", "NonHeapMemoryUsage", "jvm_memory_non_heap"),
+		presetMapping("java.lang:type=Memory", "ObjectPendingFinalizationCount", "jvm_memory_pending_finalization_count"),
+		presetMapping("java.lang:type=MemoryPool,name=*", "Usage", "jvm_memory_pool"),
+		presetCounter("java.lang:type=GarbageCollector,name=*", "CollectionCount", "jvm_gc"),
+		presetCounter("java.lang:type=GarbageCollector,name=*", "CollectionTime", "jvm_gc"),
+		presetMapping("java.lang:type=Threading", "ThreadCount", "jvm_threads_count"),
+		presetMapping("java.lang:type=Threading", "DaemonThreadCount", "jvm_threads_daemon_count"),
+		presetMapping("java.lang:type=Threading", "PeakThreadCount", "jvm_threads_peak_count"),
+		presetCounter("java.lang:type=Threading", "TotalStartedThreadCount", "jvm_threads_started_total"),
+		presetMapping("java.lang:type=ClassLoading", "LoadedClassCount", "jvm_classes_loaded_count"),
+		presetCounter("java.lang:type=ClassLoading", "TotalLoadedClassCount", "jvm_classes_loaded_total"),
+		presetCounter("java.lang:type=ClassLoading", "UnloadedClassCount", "jvm_classes_unloaded_total"),
+		presetMapping("java.lang:type=OperatingSystem", "AvailableProcessors", "jvm_os_available_processors"),
+		presetMapping("java.lang:type=OperatingSystem", "SystemLoadAverage", "jvm_os_system_load_average"),
+		presetMapping("java.lang:type=OperatingSystem", "ProcessCpuLoad", "jvm_os_process_cpu_load"),
+		presetMapping("java.lang:type=OperatingSystem", "SystemCpuLoad", "jvm_os_system_cpu_load"),
+		presetCounter("java.lang:type=OperatingSystem", "ProcessCpuTime", "jvm_os_process_cpu_time"),
+		presetMapping("java.lang:type=OperatingSystem", "OpenFileDescriptorCount", "jvm_os_open_file_descriptors"),
+		presetMapping("java.lang:type=OperatingSystem", "MaxFileDescriptorCount", "jvm_os_max_file_descriptors"),
+		presetMapping("java.lang:type=OperatingSystem", "CommittedVirtualMemorySize", "jvm_os_committed_virtual_memory_size"),
+		presetMapping("java.lang:type=OperatingSystem", "FreePhysicalMemorySize", "jvm_os_free_physical_memory_size"),
+		presetMapping("java.lang:type=OperatingSystem", "TotalPhysicalMemorySize", "jvm_os_total_physical_memory_size"),
+		presetMapping("java.lang:type=Runtime", "Uptime", "jvm_runtime_uptime"),
+	},
+	"tomcat": {
+		presetCounter("Catalina:type=GlobalRequestProcessor,name=*", "requestCount", "tomcat_requests"),
+		presetCounter("Catalina:type=GlobalRequestProcessor,name=*", "errorCount", "tomcat_requests"),
+		presetCounter("Catalina:type=GlobalRequestProcessor,name=*", "processingTime", "tomcat_requests"),
+		presetMapping("Catalina:type=GlobalRequestProcessor,name=*", "maxTime", "tomcat_requests"),
+		presetCounter("Catalina:type=GlobalRequestProcessor,name=*", "bytesReceived", "tomcat_requests"),
+		presetCounter("Catalina:type=GlobalRequestProcessor,name=*", "bytesSent", "tomcat_requests"),
+		presetMapping("Catalina:type=ThreadPool,name=*", "currentThreadCount", "tomcat_thread_pool"),
+		presetMapping("Catalina:type=ThreadPool,name=*", "currentThreadsBusy", "tomcat_thread_pool"),
+		presetMapping("Catalina:type=ThreadPool,name=*", "maxThreads", "tomcat_thread_pool"),
+		presetMapping("Catalina:type=ThreadPool,name=*", "connectionCount", "tomcat_thread_pool"),
+		presetMapping("Catalina:type=Manager,host=*,context=*", "activeSessions", "tomcat_sessions"),
+		presetCounter("Catalina:type=Manager,host=*,context=*", "sessionCounter", "tomcat_sessions"),
+		presetCounter("Catalina:type=Manager,host=*,context=*", "expiredSessions", "tomcat_sessions"),
+		presetCounter("Catalina:type=Manager,host=*,context=*", "rejectedSessions", "tomcat_sessions"),
+	},
+	"kafka": {
+		presetCounter("kafka.server:type=BrokerTopicMetrics,name=MessagesInPerSec", "Count", "kafka_server_messages_in_total"),
+		presetCounter("kafka.server:type=BrokerTopicMetrics,name=BytesInPerSec", "Count", "kafka_server_bytes_in_total"),
+		presetCounter("kafka.server:type=BrokerTopicMetrics,name=BytesOutPerSec", "Count", "kafka_server_bytes_out_total"),
+		presetCounter("kafka.server:type=BrokerTopicMetrics,name=TotalProduceRequestsPerSec", "Count", "kafka_server_produce_requests_total"),
+		presetCounter("kafka.server:type=BrokerTopicMetrics,name=TotalFetchRequestsPerSec", "Count", "kafka_server_fetch_requests_total"),
+		presetCounter("kafka.server:type=BrokerTopicMetrics,name=FailedProduceRequestsPerSec", "Count", "kafka_server_failed_produce_requests_total"),
+		presetCounter("kafka.server:type=BrokerTopicMetrics,name=FailedFetchRequestsPerSec", "Count", "kafka_server_failed_fetch_requests_total"),
+		presetMapping("kafka.server:type=ReplicaManager,name=PartitionCount", "Value", "kafka_server_partitions"),
+		presetMapping("kafka.server:type=ReplicaManager,name=LeaderCount", "Value", "kafka_server_leaders"),
+		presetMapping("kafka.server:type=ReplicaManager,name=UnderReplicatedPartitions", "Value", "kafka_server_under_replicated_partitions"),
+		presetCounter("kafka.server:type=ReplicaManager,name=IsrShrinksPerSec", "Count", "kafka_server_isr_shrinks_total"),
+		presetCounter("kafka.server:type=ReplicaManager,name=IsrExpandsPerSec", "Count", "kafka_server_isr_expands_total"),
+		presetMapping("kafka.server:type=KafkaRequestHandlerPool,name=RequestHandlerAvgIdlePercent", "OneMinuteRate", "kafka_server_request_handler_avg_idle_percent"),
+		presetMapping("kafka.network:type=SocketServer,name=NetworkProcessorAvgIdlePercent", "Value", "kafka_network_processor_avg_idle_percent"),
+		presetCounter("kafka.network:type=RequestMetrics,name=RequestsPerSec,request=*", "Count", "kafka_network_requests"),
+		presetMapping("kafka.controller:type=KafkaController,name=ActiveControllerCount", "Value", "kafka_controller_active_controllers"),
+		presetMapping("kafka.controller:type=KafkaController,name=OfflinePartitionsCount", "Value", "kafka_controller_offline_partitions"),
+	},
+	"activemq": {
+		presetCounter("org.apache.activemq:type=Broker,brokerName=*", "TotalEnqueueCount", "activemq_broker"),
+		presetCounter("org.apache.activemq:type=Broker,brokerName=*", "TotalDequeueCount", "activemq_broker"),
+		presetMapping("org.apache.activemq:type=Broker,brokerName=*", "TotalMessageCount", "activemq_broker"),
+		presetMapping("org.apache.activemq:type=Broker,brokerName=*", "TotalConsumerCount", "activemq_broker"),
+		presetMapping("org.apache.activemq:type=Broker,brokerName=*", "TotalProducerCount", "activemq_broker"),
+		presetMapping("org.apache.activemq:type=Broker,brokerName=*", "MemoryPercentUsage", "activemq_broker"),
+		presetMapping("org.apache.activemq:type=Broker,brokerName=*", "StorePercentUsage", "activemq_broker"),
+		presetMapping("org.apache.activemq:type=Broker,brokerName=*", "TempPercentUsage", "activemq_broker"),
+		presetMapping("org.apache.activemq:type=Broker,brokerName=*,destinationType=Queue,destinationName=*", "QueueSize", "activemq_queue"),
+		presetCounter("org.apache.activemq:type=Broker,brokerName=*,destinationType=Queue,destinationName=*", "EnqueueCount", "activemq_queue"),
+		presetCounter("org.apache.activemq:type=Broker,brokerName=*,destinationType=Queue,destinationName=*", "DequeueCount", "activemq_queue"),
+		presetCounter("org.apache.activemq:type=Broker,brokerName=*,destinationType=Queue,destinationName=*", "ExpiredCount", "activemq_queue"),
+		presetMapping("org.apache.activemq:type=Broker,brokerName=*,destinationType=Queue,destinationName=*", "ConsumerCount", "activemq_queue"),
+		presetMapping("org.apache.activemq:type=Broker,brokerName=*,destinationType=Queue,destinationName=*", "ProducerCount", "activemq_queue"),
+	},
+	"cassandra": {
+		presetCounter("org.apache.cassandra.metrics:type=ClientRequest,scope=Read,name=Latency", "Count", "cassandra_client_request_read_latency_count"),
+		presetMapping("org.apache.cassandra.metrics:type=ClientRequest,scope=Read,name=Latency", "99thPercentile", "cassandra_client_request_read_latency_99th_percentile"),
+		presetCounter("org.apache.cassandra.metrics:type=ClientRequest,scope=Write,name=Latency", "Count", "cassandra_client_request_write_latency_count"),
+		presetMapping("org.apache.cassandra.metrics:type=ClientRequest,scope=Write,name=Latency", "99thPercentile", "cassandra_client_request_write_latency_99th_percentile"),
+		presetCounter("org.apache.cassandra.metrics:type=ClientRequest,scope=Read,name=Timeouts", "Count", "cassandra_client_request_read_timeouts_total"),
+		presetCounter("org.apache.cassandra.metrics:type=ClientRequest,scope=Write,name=Timeouts", "Count", "cassandra_client_request_write_timeouts_total"),
+		presetCounter("org.apache.cassandra.metrics:type=ClientRequest,scope=Read,name=Unavailables", "Count", "cassandra_client_request_read_unavailables_total"),
+		presetCounter("org.apache.cassandra.metrics:type=ClientRequest,scope=Write,name=Unavailables", "Count", "cassandra_client_request_write_unavailables_total"),
+		presetMapping("org.apache.cassandra.metrics:type=Storage,name=Load", "Count", "cassandra_storage_load_bytes"),
+		presetMapping("org.apache.cassandra.metrics:type=Compaction,name=PendingTasks", "Value", "cassandra_compaction_pending_tasks"),
+		presetCounter("org.apache.cassandra.metrics:type=Compaction,name=CompletedTasks", "Value", "cassandra_compaction_completed_tasks_total"),
+		presetMapping("org.apache.cassandra.metrics:type=Cache,scope=KeyCache,name=HitRate", "Value", "cassandra_key_cache_hit_rate"),
+		presetMapping("org.apache.cassandra.metrics:type=ThreadPools,path=request,scope=*,name=PendingTasks", "Value", "cassandra_thread_pools_pending_tasks"),
+		presetCounter("org.apache.cassandra.metrics:type=DroppedMessage,scope=*,name=Dropped", "Count", "cassandra_dropped_messages"),
+	},
+	"hikaricp": {
+		presetMapping("com.zaxxer.hikari:type=Pool (*)", "ActiveConnections", "hikaricp_pool"),
+		presetMapping("com.zaxxer.hikari:type=Pool (*)", "IdleConnections", "hikaricp_pool"),
+		presetMapping("com.zaxxer.hikari:type=Pool (*)", "TotalConnections", "hikaricp_pool"),
+		presetMapping("com.zaxxer.hikari:type=Pool (*)", "ThreadsAwaitingConnection", "hikaricp_pool"),
+	},
+}
+
+func presetMapping(mbean, attribute, target string) MetricMapping {
+	return MetricMapping{
+		Source: MetricSource{Mbean: mbean, Attribute: attribute},
+		Target: target,
+	}
+}
+
+// presetCounter returns a preset mapping of a monotonic value, which is exported as counter
+func presetCounter(mbean, attribute, target string) MetricMapping {
+	m := presetMapping(mbean, attribute, target)
+	m.Type = MetricTypeCounter
+	return m
+}
+
+// PresetNames returns the names of all available presets
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// presetMetrics appends the metrics of the given presets to metrics. Metrics of a preset
+// are skipped if there already is a metric for the same source, so custom mappings take
+// precedence over the presets.
+func presetMetrics(metrics []MetricMapping, names ...string) ([]MetricMapping, error) {
+	sources := make(map[MetricSource]bool, len(metrics))
+	for _, m := range metrics {
+		sources[presetSourceKey(m.Source)] = true
+	}
+
+	for _, name := range names {
+		preset, ok := presets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset %q, available presets are %v", name, PresetNames())
+		}
+
+		for _, m := range preset {
+			if key := presetSourceKey(m.Source); !sources[key] {
+				sources[key] = true
+				metrics = append(metrics, m)
+			}
+		}
+	}
+
+	return metrics, nil
+}
+
+func presetSourceKey(source MetricSource) MetricSource {
+	source.Mbean = sortMbeanName(source.Mbean)
+	return source
+}
+
+// AddPresets adds the metrics of the given presets to the top level metrics of the config
+func (c *Config) AddPresets(names ...string) error {
+	metrics, err := presetMetrics(c.Metrics, names...)
+	if err != nil {
+		return err
+	}
+
+	fixMbeanNames(metrics)
+	c.Metrics = metrics
+	return nil
+}
@@ -0,0 +1,199 @@
+package jolokia
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/log"
+)
+
+// PushConfig configures how metrics are pushed to a pushgateway
+type PushConfig struct {
+	URL              string
+	Job              string
+	Grouping         map[string]string
+	Interval         time.Duration
+	DeleteOnShutdown bool
+	// Timeout limits every request to the pushgateway, 10s if it's 0
+	Timeout time.Duration
+}
+
+// Pusher collects metrics in an interval and pushes them to a pushgateway, which is useful
+// for jolokia endpoints prometheus can't scrape.
+type Pusher struct {
+	logger   log.Logger
+	config   PushConfig
+	registry *prometheus.Registry
+	err      error
+	client   *http.Client
+}
+
+// NewPusher returns a Pusher pushing the metrics of the given collectors
+func NewPusher(logger log.Logger, config PushConfig, collectors ...prometheus.Collector) *Pusher {
+	if config.Interval <= 0 {
+		config.Interval = defaultPushInterval
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultPushTimeout
+	}
+
+	p := &Pusher{
+		logger:   logger,
+		config:   config,
+		registry: prometheus.NewRegistry(),
+		client:   &http.Client{Timeout: config.Timeout},
+	}
+
+	// like the push package, a collector that can't be registered fails every push
+	for _, c := range collectors {
+		if err := p.registry.Register(c); err != nil && p.err == nil {
+			p.err = err
+		}
+	}
+
+	return p
+}
+
+// Run pushes the metrics in the configured interval until stop is closed. On shutdown the
+// metrics are pushed a last time and deleted from the pushgateway if configured.
+func (p *Pusher) Run(stop <-chan struct{}) error {
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Push(); err != nil {
+			p.logger.Errorf("Error pushing metrics: %v", err)
+		}
+
+		select {
+		case <-stop:
+			return p.shutdown()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Pusher) shutdown() error {
+	if err := p.Push(); err != nil {
+		return err
+	}
+
+	if !p.config.DeleteOnShutdown {
+		return nil
+	}
+
+	return p.Delete()
+}
+
+// Push collects the metrics and replaces the metrics of the grouping on the pushgateway.
+// The request is sent like the push package does, but both 202, answered by pushgateways
+// before 0.10, and 200 are accepted.
+func (p *Pusher) Push() error {
+	p.logger.Debugf("Pushing metrics to %s", p.config.URL)
+
+	if p.err != nil {
+		return p.err
+	}
+
+	families, err := p.registry.Gather()
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	enc := expfmt.NewEncoder(buf, expfmt.FmtProtoDelim)
+	for _, family := range families {
+		if err := enc.Encode(family); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPut, p.groupingURL(), buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", string(expfmt.FmtProtoDelim))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("unexpected status code %d while pushing to %s: %s", resp.StatusCode, p.groupingURL(), bytes.TrimSpace(body))
+	}
+
+	return nil
+}
+
+// Delete deletes all metrics of the grouping from the pushgateway
+func (p *Pusher) Delete() error {
+	p.logger.Debugf("Deleting metrics from %s", p.config.URL)
+
+	req, err := http.NewRequest(http.MethodDelete, p.groupingURL(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d while deleting %s", resp.StatusCode, p.groupingURL())
+	}
+
+	return nil
+}
+
+// groupingURL returns the url of the grouping the metrics are pushed to, like
+// http://pushgateway:9091/metrics/job/batch/instance/worker-1
+func (p *Pusher) groupingURL() string {
+	base := p.config.URL
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	base = strings.TrimSuffix(base, "/")
+
+	components := []string{groupingComponent("job", p.config.Job)}
+
+	names := make([]string, 0, len(p.config.Grouping))
+	for name := range p.config.Grouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		components = append(components, groupingComponent(name, p.config.Grouping[name]))
+	}
+
+	return fmt.Sprintf("%s/metrics/%s", base, strings.Join(components, "/"))
+}
+
+// groupingComponent returns the path segments of a grouping label. Values containing a
+// slash, which can't be a path segment, and empty values are base64 encoded in the
+// name@base64 form of the pushgateway, other values are path escaped.
+func groupingComponent(name, value string) string {
+	if value == "" {
+		return name + "@base64/="
+	}
+	if strings.Contains(value, "/") {
+		return name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+
+	return name + "/" + url.PathEscape(value)
+}
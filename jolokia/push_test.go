@@ -0,0 +1,189 @@
+package jolokia
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+type pushRequest struct {
+	method string
+	path   string
+	body   string
+}
+
+func TestPusher_Run(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(testHandler))
+	defer agent.Close()
+
+	mutex := sync.Mutex{}
+	requests := make([]pushRequest, 0)
+	pushed := make(chan struct{}, 100)
+
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+
+		mutex.Lock()
+		requests = append(requests, pushRequest{method: r.Method, path: r.URL.Path, body: string(b)})
+		mutex.Unlock()
+
+		w.WriteHeader(http.StatusAccepted)
+		pushed <- struct{}{}
+	}))
+	defer gateway.Close()
+
+	buf := bytes.NewBufferString("")
+	logger := log.NewLogger(buf)
+	logger.SetLevel("warn")
+
+	exp, err := NewExporter(ClientOptions{Logger: logger, Config: expectedConfig, Namespace: Namespace, Target: TargetConfig{URL: agent.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pusher := NewPusher(logger, PushConfig{
+		URL:              gateway.URL,
+		Job:              "batch",
+		Grouping:         map[string]string{"instance": "worker-1"},
+		Interval:         10 * time.Millisecond,
+		DeleteOnShutdown: true,
+	}, exp)
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- pusher.Run(stop)
+	}()
+
+	<-pushed
+	<-pushed
+	close(stop)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(requests) < 4 {
+		t.Fatalf("Expected at least 2 interval pushes, a final push and a delete, got %d requests", len(requests))
+	}
+
+	for _, req := range requests[:len(requests)-1] {
+		if req.method != http.MethodPut || req.path != "/metrics/job/batch/instance/worker-1" {
+			t.Errorf("Unexpected push request %s %s", req.method, req.path)
+		}
+	}
+
+	if !strings.Contains(requests[0].body, "jolokia_java_threading_thread_count") {
+		t.Errorf("Expected pushed metrics to contain jolokia metrics, got %q", requests[0].body)
+	}
+
+	last := requests[len(requests)-1]
+	if last.method != http.MethodDelete || last.path != "/metrics/job/batch/instance/worker-1" {
+		t.Errorf("Expected last request to delete the grouping, got %s %s", last.method, last.path)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("unexpected push output: %v", buf.String())
+	}
+}
+
+func TestPusher_PushStatus(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(testHandler))
+	defer agent.Close()
+
+	exp, err := NewExporter(ClientOptions{Logger: log.Base(), Config: expectedConfig, Namespace: Namespace, Target: TargetConfig{URL: agent.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pushgateways since 0.10 answer pushes with 200, earlier ones with 202
+	for status, success := range map[int]bool{http.StatusOK: true, http.StatusAccepted: true, http.StatusBadRequest: false} {
+		gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPut || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/vnd.google.protobuf") {
+				t.Errorf("Unexpected push request %s with content type %q", r.Method, r.Header.Get("Content-Type"))
+			}
+			w.WriteHeader(status)
+		}))
+
+		err := NewPusher(log.Base(), PushConfig{URL: gateway.URL, Job: "batch"}, exp).Push()
+		gateway.Close()
+
+		if success && err != nil {
+			t.Errorf("Expected push answered with %d to succeed, got %v", status, err)
+		} else if !success && err == nil {
+			t.Errorf("Expected push answered with %d to fail", status)
+		}
+	}
+}
+
+func TestPusher_PushTimeout(t *testing.T) {
+	release := make(chan struct{})
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer gateway.Close()
+	defer close(release)
+
+	start := time.Now()
+	err := NewPusher(log.Base(), PushConfig{URL: gateway.URL, Job: "batch", Timeout: 50 * time.Millisecond}).Push()
+	if err == nil {
+		t.Fatal("Expected a push to a hung gateway to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the push to time out, it took %s", elapsed)
+	}
+}
+
+func TestPusher_PushTargets(t *testing.T) {
+	agent := httptest.NewServer(newTestAgent(nil))
+	defer agent.Close()
+
+	config := *expectedConfig
+	config.Targets = []TargetConfig{{Name: "app-1", URL: agent.URL}, {Name: "app-2", URL: agent.URL}}
+
+	targets, err := NewTargets(log.Base(), &config, Namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body []byte
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	// Targets is an unchecked collector, registering it must not fail the pushes
+	if err := NewPusher(log.Base(), PushConfig{URL: gateway.URL, Job: "batch"}, targets).Push(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range []string{"app-1", "app-2"} {
+		if !bytes.Contains(body, []byte(target)) {
+			t.Errorf("Expected the pushed metrics to contain target %s", target)
+		}
+	}
+}
+
+func TestPusher_GroupingURL(t *testing.T) {
+	pusher := NewPusher(log.Base(), PushConfig{
+		URL:      "pushgateway:9091/",
+		Job:      "batch jobs",
+		Grouping: map[string]string{"instance": "worker 1+2", "path": "/var/lib/app", "zone": ""},
+	})
+
+	expected := "http://pushgateway:9091/metrics/job/batch%20jobs/instance/worker%201+2/path@base64/L3Zhci9saWIvYXBw/zone@base64/="
+	if u := pusher.groupingURL(); u != expected {
+		t.Errorf("Expected grouping url %s, got %s", expected, u)
+	}
+}
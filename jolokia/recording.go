@@ -0,0 +1,271 @@
+package jolokia
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Recording holds the requests sent to jolokia endpoints together with their raw
+// responses. It's written by a Recorder and replays the responses as http.RoundTripper,
+// so metrics can be reproduced without a live agent.
+type Recording struct {
+	Time      time.Time  `json:"time"`
+	Exchanges []Exchange `json:"exchanges"`
+}
+
+// An Exchange is a single request to a jolokia endpoint and its response. Responses that
+// aren't JSON, e.g. error pages, are stored as JSON string.
+type Exchange struct {
+	URL        string          `json:"url"`
+	Request    json.RawMessage `json:"request"`
+	StatusCode int             `json:"statusCode"`
+	Response   json.RawMessage `json:"response"`
+}
+
+// LoadRecording reads a recording written by Recording.Save
+func LoadRecording(file string) (*Recording, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	recording := &Recording{}
+	if err := json.Unmarshal(b, recording); err != nil {
+		return nil, fmt.Errorf("error decoding recording %s: %v", file, err)
+	}
+
+	return recording, nil
+}
+
+// Save writes the recording as indented JSON
+func (r *Recording) Save(file string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, append(b, '\n'), 0644)
+}
+
+// URLs returns the distinct endpoint URLs of the recording in recording order
+func (r *Recording) URLs() []string {
+	seen := make(map[string]bool)
+	urls := make([]string, 0)
+	for _, exchange := range r.Exchanges {
+		if !seen[exchange.URL] {
+			seen[exchange.URL] = true
+			urls = append(urls, exchange.URL)
+		}
+	}
+
+	return urls
+}
+
+// RoundTrip answers a request with the recorded response to the same request body. A
+// response recorded for the same URL is preferred, so recordings of multiple endpoints
+// with the same config can be replayed, but the endpoint may differ from the recorded
+// one. If the same body wasn't recorded, e.g. because mappings with an interval are left
+// out of later scrapes, the entries of a bulk request are answered one by one with the
+// responses recorded for them. Implements http.RoundTripper.
+func (r *Recording) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var match *Exchange
+	for i := range r.Exchanges {
+		exchange := &r.Exchanges[i]
+		if !bytes.Equal(compactJSON(exchange.Request), body) {
+			continue
+		}
+
+		if exchange.URL == req.URL.String() {
+			match = exchange
+			break
+		}
+		if match == nil {
+			match = exchange
+		}
+	}
+
+	if match == nil {
+		response, ok := r.bulkResponse(req.URL.String(), body)
+		if !ok {
+			return nil, fmt.Errorf("no recorded response for request to %s", req.URL)
+		}
+
+		match = &Exchange{StatusCode: http.StatusOK, Response: response}
+	}
+
+	response := []byte(match.Response)
+	var text string
+	if json.Unmarshal(match.Response, &text) == nil {
+		response = []byte(text)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", match.StatusCode, http.StatusText(match.StatusCode)),
+		StatusCode:    match.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(response)),
+		ContentLength: int64(len(response)),
+		Request:       req,
+	}, nil
+}
+
+// bulkResponse assembles the response to a bulk request from the responses recorded for
+// each of its entries, it returns false if an entry wasn't recorded
+func (r *Recording) bulkResponse(url string, body []byte) (json.RawMessage, bool) {
+	var entries []json.RawMessage
+	if json.Unmarshal(body, &entries) != nil || len(entries) == 0 {
+		return nil, false
+	}
+
+	responses := make([]json.RawMessage, 0, len(entries))
+	for _, entry := range entries {
+		response, ok := r.entryResponse(url, compactJSON(entry))
+		if !ok {
+			return nil, false
+		}
+		responses = append(responses, response)
+	}
+
+	b, err := json.Marshal(responses)
+	return b, err == nil
+}
+
+// entryResponse returns the response recorded for an entry of a successful bulk request,
+// the entries of a bulk response are in the order of the request. A response recorded for
+// the same URL is preferred.
+func (r *Recording) entryResponse(url string, entry []byte) (json.RawMessage, bool) {
+	var match json.RawMessage
+	for _, exchange := range r.Exchanges {
+		if exchange.StatusCode != http.StatusOK {
+			continue
+		}
+
+		var requests, responses []json.RawMessage
+		if json.Unmarshal(exchange.Request, &requests) != nil || json.Unmarshal(exchange.Response, &responses) != nil || len(requests) != len(responses) {
+			continue
+		}
+
+		for i, request := range requests {
+			if !bytes.Equal(compactJSON(request), entry) {
+				continue
+			}
+
+			if exchange.URL == url {
+				return responses[i], true
+			}
+			if match == nil {
+				match = responses[i]
+			}
+		}
+	}
+
+	return match, match != nil
+}
+
+// Recorder records the requests and responses of the transports it wraps
+type Recorder struct {
+	mutex     sync.Mutex
+	exchanges []Exchange
+}
+
+// NewRecorder returns an empty Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{exchanges: make([]Exchange, 0)}
+}
+
+// Transport returns a transport sending requests with next and recording their responses
+func (r *Recorder) Transport(next http.RoundTripper) http.RoundTripper {
+	return recordingTransport{recorder: r, next: next}
+}
+
+// Recording returns the exchanges recorded so far
+func (r *Recorder) Recording() *Recording {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	exchanges := make([]Exchange, len(r.exchanges))
+	copy(exchanges, r.exchanges)
+
+	return &Recording{Time: time.Now(), Exchanges: exchanges}
+}
+
+type recordingTransport struct {
+	recorder *Recorder
+	next     http.RoundTripper
+}
+
+func (t recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	response, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(response))
+
+	recorded := json.RawMessage(compactJSON(response))
+	if !json.Valid(response) {
+		recorded, _ = json.Marshal(strings.TrimSpace(string(response)))
+	}
+
+	t.recorder.mutex.Lock()
+	t.recorder.exchanges = append(t.recorder.exchanges, Exchange{
+		URL:        req.URL.String(),
+		Request:    json.RawMessage(body),
+		StatusCode: resp.StatusCode,
+		Response:   recorded,
+	})
+	t.recorder.mutex.Unlock()
+
+	return resp, nil
+}
+
+// readRequestBody reads the compacted body of a request and replaces it, so the request can
+// still be sent
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return compactJSON(body), nil
+}
+
+// compactJSON removes insignificant whitespace from JSON, invalid JSON is returned as is
+func compactJSON(b []byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	if err := json.Compact(buf, b); err != nil {
+		return b
+	}
+
+	return buf.Bytes()
+}
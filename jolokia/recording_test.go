@@ -0,0 +1,162 @@
+package jolokia
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/log"
+)
+
+func TestRecording_RecordAndReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(authTestHandler))
+
+	recorder := NewRecorder()
+	client, err := NewClient(ClientOptions{
+		Config:    expectedConfig,
+		Namespace: Namespace,
+		Target:    TargetConfig{URL: srv.URL, BasicAuth: &BasicAuth{Username: "admin", Password: "secret"}},
+		Transport: recorder.Transport(http.DefaultTransport),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Scrape(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "recording")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "recording.json")
+	if err := recorder.Recording().Save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	// the agent is gone, the metrics are served from the recording only
+	srv.Close()
+
+	recording, err := LoadRecording(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recording.Exchanges) != 1 || recording.Exchanges[0].URL != srv.URL {
+		t.Fatalf("Expected a single exchange with %s, got %v", srv.URL, recording.Exchanges)
+	}
+
+	buf := bytes.NewBufferString("")
+	logger := log.NewLogger(buf)
+	logger.SetLevel("warn")
+
+	exp, err := NewExporter(ClientOptions{
+		Logger:    logger,
+		Config:    expectedConfig,
+		Namespace: Namespace,
+		Target:    TargetConfig{URL: "http://replayed/jolokia"},
+		Transport: recording,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exp)
+
+	rw := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected replay output: %v", buf.String())
+	}
+
+	if expected := getPromResponse(t); !strings.Contains(rw.Body.String(), expected) {
+		t.Errorf("expected replayed metrics %s, got %s", expected, rw.Body.String())
+	}
+}
+
+func TestRecording_RoundTrip(t *testing.T) {
+	recording := &Recording{Exchanges: []Exchange{
+		{URL: "http://a/jolokia", Request: []byte(`[{"type":"read"}]`), StatusCode: http.StatusOK, Response: []byte(`[{"status":200}]`)},
+		{URL: "http://b/jolokia", Request: []byte(`[{"type":"read"}]`), StatusCode: http.StatusUnauthorized, Response: []byte(`"Wrong credentials"`)},
+	}}
+
+	tests := []struct {
+		url    string
+		status int
+		body   string
+	}{
+		{"http://a/jolokia", http.StatusOK, `[{"status":200}]`},
+		{"http://b/jolokia", http.StatusUnauthorized, "Wrong credentials"},
+		{"http://c/jolokia", http.StatusOK, `[{"status":200}]`},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodPost, test.url, strings.NewReader(`[ {"type": "read"} ]`))
+		resp, err := recording.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != test.status || string(body) != test.body {
+			t.Errorf("Expected %d %s for %s, got %d %s", test.status, test.body, test.url, resp.StatusCode, body)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "http://a/jolokia", strings.NewReader(`[{"type":"list"}]`))
+	if _, err := recording.RoundTrip(req); err == nil {
+		t.Error("Expected an error for a request that wasn't recorded")
+	}
+}
+
+func TestRecording_ReplayInterval(t *testing.T) {
+	srv := httptest.NewServer(newTestAgent(nil))
+
+	config := &Config{
+		Metrics: []MetricMapping{
+			{Source: MetricSource{Mbean: "java.lang:type=Threading", Attribute: "ThreadCount"}, Target: "threads"},
+			{Source: MetricSource{Mbean: "java.lang:type=OperatingSystem", Attribute: "ProcessCpuLoad"}, Target: "cpu_load", Interval: Duration(time.Hour)},
+		},
+	}
+
+	recorder := NewRecorder()
+	client, err := NewClient(ClientOptions{Config: config, Namespace: Namespace, Target: TargetConfig{URL: srv.URL}, Transport: recorder.Transport(http.DefaultTransport)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Scrape(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	// the replaying client sends the full request first, then only the mappings that are due
+	replay, err := NewClient(ClientOptions{Config: config, Namespace: Namespace, Target: TargetConfig{URL: srv.URL}, Transport: recorder.Recording()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		result, err := replay.Scrape(context.Background())
+		if err != nil {
+			t.Fatalf("Expected scrape %d to be replayed, got %v", i+1, err)
+		}
+		if !result.Reached || len(result.Samples) != 2 {
+			t.Errorf("Expected the samples of both mappings, got %+v", result)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package jolokia
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/common/log"
+)
+
+const (
+	defaultRemoteWriteTimeout = 10 * time.Second
+	defaultQueueCapacity      = 10
+	defaultQueueMaxRetries    = 10
+	defaultQueueMinBackoff    = 100 * time.Millisecond
+	defaultQueueMaxBackoff    = 10 * time.Second
+)
+
+// RemoteWriter collects samples in an interval and sends them to a prometheus remote_write
+// receiver. Requests are queued and retried with backoff if the receiver is unavailable,
+// if the queue is full the oldest request is dropped.
+type RemoteWriter struct {
+	logger log.Logger
+	config RemoteWriteConfig
+	source SampleSource
+
+	client            *http.Client
+	basicAuthUser     string
+	basicAuthPassword string
+
+	queue chan []byte
+}
+
+// recoverableError marks errors after which sending a request should be retried
+type recoverableError struct {
+	error
+}
+
+// NewRemoteWriter returns a RemoteWriter sending the samples of the given source
+func NewRemoteWriter(logger log.Logger, config RemoteWriteConfig, source SampleSource) (*RemoteWriter, error) {
+	client, err := newHTTPClient(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Timeout = defaultRemoteWriteTimeout
+	if config.Timeout > 0 {
+		client.Timeout = time.Duration(config.Timeout)
+	}
+
+	user, password, err := config.BasicAuth.credentials()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read password file for %s: %v", config.URL, err)
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = Duration(defaultPushInterval)
+	}
+	if config.Queue.Capacity <= 0 {
+		config.Queue.Capacity = defaultQueueCapacity
+	}
+	if config.Queue.MaxRetries <= 0 {
+		config.Queue.MaxRetries = defaultQueueMaxRetries
+	}
+	if config.Queue.MinBackoff <= 0 {
+		config.Queue.MinBackoff = Duration(defaultQueueMinBackoff)
+	}
+	if config.Queue.MaxBackoff <= 0 {
+		config.Queue.MaxBackoff = Duration(defaultQueueMaxBackoff)
+	}
+
+	return &RemoteWriter{
+		logger:            logger,
+		config:            config,
+		source:            source,
+		client:            client,
+		basicAuthUser:     user,
+		basicAuthPassword: password,
+		queue:             make(chan []byte, config.Queue.Capacity),
+	}, nil
+}
+
+// Run collects samples in the configured interval until stop is closed. Queued requests
+// are sent in the background.
+func (w *RemoteWriter) Run(stop <-chan struct{}) {
+	go w.sendQueue(stop)
+
+	ticker := time.NewTicker(time.Duration(w.config.Interval))
+	defer ticker.Stop()
+
+	for {
+		w.enqueue(w.source.Samples())
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// enqueue encodes the samples as request and adds it to the queue, dropping the oldest
+// request if the queue is full
+func (w *RemoteWriter) enqueue(samples []Sample) {
+	if len(samples) == 0 {
+		return
+	}
+
+	body := snappy.Encode(nil, encodeWriteRequest(samples, w.config.ExternalLabels))
+
+	for {
+		select {
+		case w.queue <- body:
+			return
+		default:
+		}
+
+		select {
+		case <-w.queue:
+			w.logger.Warnf("Remote write queue for %s is full, dropping oldest samples", w.config.URL)
+		default:
+		}
+	}
+}
+
+func (w *RemoteWriter) sendQueue(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case body := <-w.queue:
+			if err := w.sendWithRetries(body, stop); err != nil {
+				w.logger.Errorf("Error sending samples to %s, dropping them: %v", w.config.URL, err)
+			}
+		}
+	}
+}
+
+// sendWithRetries sends the request and retries with an exponential backoff as long as the
+// error is recoverable and the maximum number of retries is not reached
+func (w *RemoteWriter) sendWithRetries(body []byte, stop <-chan struct{}) error {
+	backoff := time.Duration(w.config.Queue.MinBackoff)
+
+	for try := 0; ; try++ {
+		err := w.send(body)
+		if err == nil {
+			return nil
+		}
+
+		if _, ok := err.(recoverableError); !ok || try >= w.config.Queue.MaxRetries {
+			return err
+		}
+
+		w.logger.Debugf("Retrying to send samples to %s in %s: %v", w.config.URL, backoff, err)
+
+		select {
+		case <-stop:
+			return err
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if max := time.Duration(w.config.Queue.MaxBackoff); backoff > max {
+			backoff = max
+		}
+	}
+}
+
+func (w *RemoteWriter) send(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if w.basicAuthUser != "" || w.basicAuthPassword != "" {
+		req.SetBasicAuth(w.basicAuthUser, w.basicAuthPassword)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return recoverableError{err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+	err = fmt.Errorf("server returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		return recoverableError{err}
+	}
+
+	return err
+}
+
+// encodeWriteRequest encodes the samples as prometheus.WriteRequest protobuf message.
+// External labels are added to every series unless a series already has the label.
+func encodeWriteRequest(samples []Sample, externalLabels map[string]string) []byte {
+	var request []byte
+
+	for _, s := range samples {
+		labels := map[string]string{"__name__": s.Name}
+		for name, value := range externalLabels {
+			labels[name] = value
+		}
+		for name, value := range s.Labels {
+			labels[name] = value
+		}
+
+		names := make([]string, 0, len(labels))
+		for name := range labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var series []byte
+		for _, name := range names {
+			var label []byte
+			label = appendProtoBytes(label, 1, []byte(name))
+			label = appendProtoBytes(label, 2, []byte(labels[name]))
+			series = appendProtoBytes(series, 1, label)
+		}
+
+		var sample []byte
+		sample = appendProtoTag(sample, 1, 1)
+		sample = appendFixed64(sample, math.Float64bits(s.Value))
+		sample = appendProtoTag(sample, 2, 0)
+		sample = appendUvarint(sample, uint64(s.Timestamp.UnixNano()/int64(time.Millisecond)))
+		series = appendProtoBytes(series, 2, sample)
+
+		request = appendProtoBytes(request, 1, series)
+	}
+
+	return request
+}
+
+func appendProtoTag(b []byte, field, wireType int) []byte {
+	return appendUvarint(b, uint64(field<<3|wireType))
+}
+
+func appendProtoBytes(b []byte, field int, data []byte) []byte {
+	b = appendProtoTag(b, field, 2)
+	b = appendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendFixed64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
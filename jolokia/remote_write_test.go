@@ -0,0 +1,202 @@
+package jolokia
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+type staticSamples []Sample
+
+func (s staticSamples) Samples() []Sample {
+	return s
+}
+
+type writtenSeries struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+func TestRemoteWriter_Run(t *testing.T) {
+	timestamp := time.Unix(1520000000, 0)
+	samples := staticSamples{{
+		Name:      "jolokia_java_threading_thread_count",
+		Help:      "thread count",
+		Labels:    map[string]string{"target": "app-1", "env": "test"},
+		Type:      prometheus.GaugeValue,
+		Value:     421,
+		Timestamp: timestamp,
+	}}
+
+	mutex := sync.Mutex{}
+	statusCodes := []int{http.StatusInternalServerError, http.StatusOK}
+	requests := 0
+	written := make(chan []writtenSeries, 10)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" {
+			t.Errorf("Unexpected content encoding %q", r.Header.Get("Content-Encoding"))
+		}
+
+		compressed, _ := ioutil.ReadAll(r.Body)
+		body, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Errorf("Error decoding request body: %v", err)
+		}
+
+		mutex.Lock()
+		code := statusCodes[requests%len(statusCodes)]
+		requests++
+		mutex.Unlock()
+
+		w.WriteHeader(code)
+		if code == http.StatusOK {
+			written <- decodeWriteRequest(t, body)
+		}
+	}))
+	defer receiver.Close()
+
+	buf := bytes.NewBufferString("")
+	logger := log.NewLogger(buf)
+	logger.SetLevel("warn")
+
+	writer, err := NewRemoteWriter(logger, RemoteWriteConfig{
+		URL:            receiver.URL,
+		Interval:       Duration(time.Hour),
+		ExternalLabels: map[string]string{"env": "prod", "cluster": "eu"},
+		Queue:          QueueConfig{MinBackoff: Duration(time.Millisecond)},
+	}, samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go writer.Run(stop)
+
+	var series []writtenSeries
+	select {
+	case series = <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for remote write request")
+	}
+
+	expected := []writtenSeries{{
+		labels: map[string]string{
+			"__name__": "jolokia_java_threading_thread_count",
+			"cluster":  "eu",
+			"env":      "test",
+			"target":   "app-1",
+		},
+		value:     421,
+		timestamp: 1520000000000,
+	}}
+
+	if !reflect.DeepEqual(series, expected) {
+		t.Errorf("Expected written series %v, got %v", expected, series)
+	}
+
+	mutex.Lock()
+	if requests != 2 {
+		t.Errorf("Expected the failed request to be retried once, got %d requests", requests)
+	}
+	mutex.Unlock()
+
+	if buf.Len() != 0 {
+		t.Errorf("unexpected remote write output: %v", buf.String())
+	}
+}
+
+func TestRemoteWriter_SendNotRecoverable(t *testing.T) {
+	requests := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer receiver.Close()
+
+	writer, err := NewRemoteWriter(log.Base(), RemoteWriteConfig{
+		URL:   receiver.URL,
+		Queue: QueueConfig{MinBackoff: Duration(time.Millisecond)},
+	}, staticSamples{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writer.sendWithRetries([]byte{}, nil)
+	if err == nil {
+		t.Fatal("Expected an error for a bad request")
+	}
+
+	if requests != 1 {
+		t.Errorf("Expected a bad request not to be retried, got %d requests", requests)
+	}
+}
+
+// decodeWriteRequest decodes the series of a prometheus.WriteRequest protobuf message
+func decodeWriteRequest(t *testing.T, request []byte) []writtenSeries {
+	series := make([]writtenSeries, 0)
+
+	for _, ts := range decodeProtoFields(t, request)[1] {
+		s := writtenSeries{labels: make(map[string]string)}
+		fields := decodeProtoFields(t, ts)
+
+		for _, label := range fields[1] {
+			labelFields := decodeProtoFields(t, label)
+			s.labels[string(labelFields[1][0])] = string(labelFields[2][0])
+		}
+
+		for _, sample := range fields[2] {
+			sampleFields := decodeProtoFields(t, sample)
+			s.value = math.Float64frombits(binary.LittleEndian.Uint64(sampleFields[1][0]))
+			timestamp, _ := binary.Uvarint(sampleFields[2][0])
+			s.timestamp = int64(timestamp)
+		}
+
+		series = append(series, s)
+	}
+
+	return series
+}
+
+// decodeProtoFields returns the raw values of a protobuf message by field number, varints
+// are returned as their encoded bytes
+func decodeProtoFields(t *testing.T, message []byte) map[int][][]byte {
+	fields := make(map[int][][]byte)
+
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		message = message[n:]
+
+		var value []byte
+		switch tag & 7 {
+		case 0:
+			_, n = binary.Uvarint(message)
+			value, message = message[:n], message[n:]
+		case 1:
+			value, message = message[:8], message[8:]
+		case 2:
+			length, n := binary.Uvarint(message)
+			message = message[n:]
+			value, message = message[:length], message[length:]
+		default:
+			t.Fatalf("Unexpected wire type %d", tag&7)
+		}
+
+		fields[int(tag>>3)] = append(fields[int(tag>>3)], value)
+	}
+
+	return fields
+}
@@ -0,0 +1,285 @@
+package jolokia
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A readRequest is a read request shared by the mappings of the same mbean. Mappings
+// reading the same attribute or other attributes of the mbean are merged into a single
+// request, so the agent serializes every attribute only once, their paths are extracted
+// from the response value instead. Only mappings of the same interval share a request.
+type readRequest struct {
+	metric   RequestMetric
+	mappings []requestMapping
+	interval time.Duration
+
+	// scraped is the time of the cached samples of a request with an interval
+	scraped time.Time
+	samples []Sample
+}
+
+// due tells whether the request has to be sent, rather than using its cached samples
+func (r *readRequest) due(now time.Time) bool {
+	return r.interval <= 0 || r.scraped.IsZero() || now.Sub(r.scraped) >= r.interval
+}
+
+// A requestMapping is a mapping served by a readRequest. Its values are the ones below
+// the prefix of keys in the response value, behind the mbean key of pattern responses.
+// The first kept keys of the prefix remain part of the keys of the values, so they are
+// named as if the mapping was requested on its own. The filter selects its values by
+// their key path, it's nil if the mapping has no include or exclude patterns. The
+// templates are nil unless the target or labels of the mapping are templates.
+type requestMapping struct {
+	mapping   MetricMapping
+	prefix    []string
+	kept      int
+	filter    *keyFilter
+	templates *mappingTemplates
+}
+
+// groupRequests returns the read requests of the mappings. Mappings reading all
+// attributes of a mbean, or with paths that could contain wildcards or index into arrays,
+// are requested on their own, as their values can't be told apart in a shared response.
+// Mappings without attribute whose include patterns name the attributes only request those.
+func groupRequests(mappings []MetricMapping) []*readRequest {
+	requests := make([]*readRequest, 0)
+	single := make(map[string]*readRequest)
+	shared := make(map[string][]MetricMapping)
+	// the index of the shared request of a mbean and interval, it's built once all of its
+	// mappings are known
+	index := make(map[string]int)
+
+	for _, m := range mappings {
+		if m.Source.Attribute != "" && isSharablePath(m.Source.Path) {
+			key := fmt.Sprintf("%s %v", m.Source.Mbean, m.Interval)
+			if _, ok := index[key]; !ok {
+				index[key] = len(requests)
+				requests = append(requests, nil)
+			}
+			shared[key] = append(shared[key], m)
+			continue
+		}
+
+		metric := RequestMetric{Type: requestTypeRead, Mbean: m.Source.Mbean, Attribute: m.Source.Attribute, Path: m.Source.Path}
+		if attributes := includedAttributes(m); attributes != nil {
+			metric.Attributes = attributes
+			metric.Config = &RequestConfig{IgnoreErrors: true}
+		}
+		key := fmt.Sprintf("%s %v", metric.String(), m.Interval)
+		if r, ok := single[key]; ok {
+			r.mappings = append(r.mappings, requestMapping{mapping: m})
+			continue
+		}
+
+		r := &readRequest{metric: metric, mappings: []requestMapping{{mapping: m}}, interval: time.Duration(m.Interval)}
+		single[key] = r
+		requests = append(requests, r)
+	}
+
+	for key, i := range index {
+		requests[i] = sharedRequest(shared[key])
+	}
+
+	return requests
+}
+
+// sharedRequest returns the request of the mappings of a mbean and interval, each of them
+// reading a single attribute. A single mapping is requested as it is.
+func sharedRequest(mappings []MetricMapping) *readRequest {
+	mbean := mappings[0].Source.Mbean
+	interval := time.Duration(mappings[0].Interval)
+
+	if len(mappings) == 1 {
+		m := mappings[0]
+		return &readRequest{
+			metric:   RequestMetric{Type: requestTypeRead, Mbean: mbean, Attribute: m.Source.Attribute, Path: m.Source.Path},
+			mappings: []requestMapping{{mapping: m}},
+			interval: interval,
+		}
+	}
+
+	attributes := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, m := range mappings {
+		if !seen[m.Source.Attribute] {
+			seen[m.Source.Attribute] = true
+			attributes = append(attributes, m.Source.Attribute)
+		}
+	}
+
+	r := &readRequest{metric: RequestMetric{Type: requestTypeRead, Mbean: mbean}, interval: interval}
+	if len(attributes) == 1 {
+		r.metric.Attribute = attributes[0]
+	} else {
+		r.metric.Attributes = attributes
+		r.metric.Config = &RequestConfig{IgnoreErrors: true}
+	}
+
+	// responses to patterns always hold the values by attribute, responses to a single
+	// mbean only if several attributes were requested
+	pattern := isMbeanPattern(mbean)
+	for _, m := range mappings {
+		rm := requestMapping{mapping: m, prefix: splitPath(m.Source.Path)}
+		if pattern || len(attributes) > 1 {
+			rm.prefix = append([]string{m.Source.Attribute}, rm.prefix...)
+		}
+		if pattern {
+			rm.kept = 1
+		}
+
+		r.mappings = append(r.mappings, rm)
+	}
+
+	return r
+}
+
+// values returns the values of the mapping within the values of the response
+func (rm requestMapping) values(values []keyedValue, pattern bool) []keyedValue {
+	if len(rm.prefix) == 0 {
+		return values
+	}
+
+	offset := 0
+	if pattern {
+		offset = 1
+	}
+
+	result := make([]keyedValue, 0)
+	for _, v := range values {
+		if len(v.keys) < offset || !hasKeyPrefix(v.keys[offset:], rm.prefix) {
+			continue
+		}
+
+		keys := v.keys[offset+len(rm.prefix):]
+		if offset+rm.kept > 0 {
+			keys = append(v.keys[:offset+rm.kept:offset+rm.kept], keys...)
+		}
+
+		result = append(result, keyedValue{keys: keys, value: v.value})
+	}
+
+	return result
+}
+
+// filterValues returns the values of the mapping that pass its filter. The key path of a
+// value starts behind the mbean key of pattern responses, which also hold the values by
+// attribute if the mapping has one.
+func (rm requestMapping) filterValues(values []keyedValue, pattern bool) []keyedValue {
+	if rm.filter == nil {
+		return values
+	}
+
+	offset := rm.keyOffset(pattern)
+	result := make([]keyedValue, 0, len(values))
+	for _, v := range values {
+		if len(v.keys) >= offset && rm.filter.match(v.keys[offset:]) {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+// keyOffset returns the number of keys of the values of the mapping before their key path
+func (rm requestMapping) keyOffset(pattern bool) int {
+	if !pattern {
+		return 0
+	}
+	if rm.mapping.Source.Attribute != "" {
+		return 2
+	}
+
+	return 1
+}
+
+// templateValue returns what the templates of the mapping are rendered to for a value
+func (rm requestMapping) templateValue(v keyedValue, mbean string, pattern bool) templateValue {
+	tv := templateValue{properties: mbeanProperties(mbean), attribute: rm.mapping.Source.Attribute}
+
+	offset := rm.keyOffset(pattern)
+	if len(v.keys) >= offset {
+		tv.keys = v.keys[offset:]
+	}
+	if rm.filter != nil {
+		tv.captures = rm.filter.captures(tv.keys)
+	}
+	if tv.attribute == "" && len(tv.keys) > 0 {
+		tv.attribute = tv.keys[0]
+		tv.keys = tv.keys[1:]
+	}
+
+	return tv
+}
+
+// attributeError returns the first ignored error of an attribute read by the mapping
+func (rm requestMapping) attributeError(errors []keyedError, pattern bool) (string, bool) {
+	if len(rm.prefix) == 0 {
+		return "", false
+	}
+
+	offset := 0
+	if pattern {
+		offset = 1
+	}
+
+	for _, e := range errors {
+		if len(e.keys) > offset && hasKeyPrefix(rm.prefix, e.keys[offset:]) {
+			return e.message, true
+		}
+	}
+
+	return "", false
+}
+
+func hasKeyPrefix(keys, prefix []string) bool {
+	if len(keys) < len(prefix) {
+		return false
+	}
+
+	for i, key := range prefix {
+		if keys[i] != key {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isSharablePath tells whether the values of a path can be extracted from the value of
+// its attribute. Jolokia allows wildcards in paths and indexes into arrays, whose values
+// are skipped in responses.
+func isSharablePath(path string) bool {
+	for _, segment := range splitPath(path) {
+		if segment == "*" || strings.Trim(segment, "0123456789") == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// splitPath splits a jolokia path at slashes, !/ escapes a slash and !! an exclamation mark
+func splitPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+
+	segments := make([]string, 0)
+	segment := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '!' && i+1 < len(path):
+			i++
+			segment = append(segment, path[i])
+		case path[i] == '/':
+			segments = append(segments, string(segment))
+			segment = segment[:0]
+		default:
+			segment = append(segment, path[i])
+		}
+	}
+
+	return append(segments, string(segment))
+}
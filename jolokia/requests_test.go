@@ -0,0 +1,115 @@
+package jolokia
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func testMapping(mbean, attribute, path, target string) MetricMapping {
+	return MetricMapping{Source: MetricSource{Mbean: mbean, Attribute: attribute, Path: path}, Target: target}
+}
+
+var sharedMappings = []MetricMapping{
+	testMapping("java.lang:type=Memory", "HeapMemoryUsage", "used", "heap_memory_used"),
+	testMapping("java.lang:type=Threading", "ThreadCount", "", "threads"),
+	testMapping("java.lang:type=Memory", "HeapMemoryUsage", "max", "heap_memory_max"),
+	testMapping("java.lang:type=Memory", "HeapMemoryUsage", "", "heap"),
+	testMapping("java.lang:type=Memory", "ObjectPendingFinalizationCount", "", "pending"),
+	testMapping("java.lang:type=Memory", "NoSuchAttribute", "", "missing"),
+	testMapping("java.lang:type=OperatingSystem", "", "", "os"),
+	testMapping("java.lang:type=GarbageCollector,name=*", "CollectionCount", "", "gc"),
+	testMapping("java.lang:type=GarbageCollector,name=*", "CollectionTime", "", "gc"),
+	testMapping("java.lang:type=Threading", "ThreadCount", "0", "threads_index"),
+}
+
+func TestGroupRequests(t *testing.T) {
+	requests := groupRequests(sharedMappings)
+
+	metrics := make(Request, 0, len(requests))
+	for _, r := range requests {
+		metrics = append(metrics, r.metric)
+	}
+
+	actual, err := json.Marshal(metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `[` +
+		`{"type":"read","attribute":["HeapMemoryUsage","ObjectPendingFinalizationCount","NoSuchAttribute"],"mbean":"java.lang:type=Memory","config":{"ignoreErrors":true}},` +
+		`{"type":"read","attribute":"ThreadCount","mbean":"java.lang:type=Threading"},` +
+		`{"type":"read","mbean":"java.lang:type=OperatingSystem"},` +
+		`{"type":"read","attribute":["CollectionCount","CollectionTime"],"mbean":"java.lang:type=GarbageCollector,name=*","config":{"ignoreErrors":true}},` +
+		`{"type":"read","attribute":"ThreadCount","mbean":"java.lang:type=Threading","path":"0"}` +
+		`]`
+
+	if string(actual) != expected {
+		t.Errorf("Expected requests %s, got %s", expected, actual)
+	}
+
+	var decoded Request
+	if err := json.Unmarshal(actual, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, metrics) {
+		t.Errorf("Expected requests to decode to %v, got %v", metrics, decoded)
+	}
+}
+
+func TestClient_ScrapeSharedRequests(t *testing.T) {
+	srv := httptest.NewServer(newTestAgent(nil))
+	defer srv.Close()
+
+	scrape := func(mappings ...MetricMapping) *ScrapeResult {
+		client, err := NewClient(ClientOptions{Config: &Config{Metrics: mappings}, Namespace: Namespace, Target: TargetConfig{URL: srv.URL}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := client.Scrape(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return result
+	}
+
+	// every mapping requested on its own
+	expected := &ScrapeResult{}
+	for _, m := range sharedMappings {
+		result := scrape(m)
+		expected.Samples = append(expected.Samples, result.Samples...)
+		expected.Errors = append(expected.Errors, result.Errors...)
+	}
+
+	actual := scrape(sharedMappings...)
+
+	if len(actual.Samples) != len(expected.Samples) {
+		t.Errorf("Expected %d samples, got %d", len(expected.Samples), len(actual.Samples))
+	}
+	if diff := DiffSeries(SampleSeries(expected.Samples), SampleSeries(actual.Samples)); !diff.Empty() {
+		t.Errorf("Expected shared requests to produce the samples of single requests, got %+v", diff)
+	}
+
+	errors := []string{"missing ", "threads_index 0"}
+	if !reflect.DeepEqual(mappingErrors(expected.Errors), errors) {
+		t.Fatalf("Expected single requests to fail for mappings %v, got %v", errors, mappingErrors(expected.Errors))
+	}
+	if !reflect.DeepEqual(mappingErrors(actual.Errors), errors) {
+		t.Errorf("Expected errors of mappings %v, got %v", errors, mappingErrors(actual.Errors))
+	}
+}
+
+func mappingErrors(errors []MappingError) []string {
+	targets := make([]string, 0, len(errors))
+	for _, e := range errors {
+		targets = append(targets, e.Mapping.Target+" "+e.Mapping.Source.Path)
+	}
+	sort.Strings(targets)
+
+	return targets
+}
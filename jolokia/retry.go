@@ -0,0 +1,193 @@
+package jolokia
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// maxDiscardedBody is read of the body of a response that is retried, so the
+	// connection can be reused
+	maxDiscardedBody = 4096
+
+	// defaultScrapeTimeout is the scrape timeout of prometheus, so retries end before
+	// prometheus gives up on the scrape
+	defaultScrapeTimeout = 10 * time.Second
+
+	defaultRetryMinBackoff      = 100 * time.Millisecond
+	defaultRetryMaxBackoff      = 2 * time.Second
+	defaultBreakerProbeInterval = time.Minute
+)
+
+// Circuit breaker states as exported by the circuit_breaker_state metric
+const (
+	breakerClosed   = 0
+	breakerOpen     = 1
+	breakerHalfOpen = 2
+)
+
+// retryPolicy is a RetryConfig with defaults applied
+type retryPolicy struct {
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+func newRetryPolicy(config RetryConfig) retryPolicy {
+	p := retryPolicy{
+		maxRetries: config.MaxRetries,
+		minBackoff: time.Duration(config.MinBackoff),
+		maxBackoff: time.Duration(config.MaxBackoff),
+	}
+
+	if p.minBackoff <= 0 {
+		p.minBackoff = defaultRetryMinBackoff
+	}
+	if p.maxBackoff <= 0 {
+		p.maxBackoff = defaultRetryMaxBackoff
+	}
+	if p.maxBackoff < p.minBackoff {
+		p.maxBackoff = p.minBackoff
+	}
+
+	return p
+}
+
+// backoff returns the jittered delay before the given retry, starting at 1. The delay
+// doubles with every retry up to the maximum, a random half of it is waited for.
+func (p retryPolicy) backoff(retry int) time.Duration {
+	backoff := p.minBackoff
+	for i := 1; i < retry && backoff < p.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.maxBackoff {
+		backoff = p.maxBackoff
+	}
+
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// retryableStatus tells whether a request answered with the status should be retried
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status/100 == 5
+}
+
+// exceedsDeadline tells whether the deadline of the context passes within the delay
+func exceedsDeadline(ctx context.Context, delay time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && time.Now().Add(delay).After(deadline)
+}
+
+// sleep waits for the delay, it returns false if the context is done before
+func sleep(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// circuitBreaker fails scrapes of a target without requesting it once a number of
+// consecutive scrapes failed. It's open until the probe interval passed, then a single
+// scrape probes the target, half-open, and closes the breaker if it succeeds.
+type circuitBreaker struct {
+	threshold     int
+	probeInterval time.Duration
+
+	mutex    sync.Mutex
+	state    int
+	failures int
+	opened   time.Time
+}
+
+func newCircuitBreaker(config CircuitBreakerConfig) *circuitBreaker {
+	b := &circuitBreaker{
+		threshold:     config.FailureThreshold,
+		probeInterval: time.Duration(config.ProbeInterval),
+	}
+
+	if b.probeInterval <= 0 {
+		b.probeInterval = defaultBreakerProbeInterval
+	}
+
+	return b
+}
+
+// enabled tells whether the breaker ever opens
+func (b *circuitBreaker) enabled() bool {
+	return b.threshold > 0
+}
+
+// allow tells whether the target may be requested and whether it's a probe. An open
+// breaker allows a single probe once the probe interval passed.
+func (b *circuitBreaker) allow(now time.Time) (bool, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if now.Sub(b.opened) < b.probeInterval {
+			return false, false
+		}
+
+		b.state = breakerHalfOpen
+		return true, true
+	case breakerHalfOpen:
+		// a probe is in progress
+		return false, false
+	default:
+		return true, false
+	}
+}
+
+// record records the outcome of a scrape that was allowed
+func (b *circuitBreaker) record(success bool, now time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if success {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.enabled() && (b.state == breakerHalfOpen || b.failures >= b.threshold) {
+		b.state = breakerOpen
+		b.opened = now
+	}
+}
+
+// State returns breakerClosed, breakerOpen or breakerHalfOpen
+func (b *circuitBreaker) State() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.state
+}
+
+// errBreakerOpen is returned for scrapes failed by an open circuit breaker
+type errBreakerOpen struct {
+	failures int
+	probe    time.Time
+}
+
+func (e errBreakerOpen) Error() string {
+	return fmt.Sprintf("circuit breaker is open after %d consecutive failed scrapes, next probe at %s", e.failures, e.probe.Format(time.RFC3339))
+}
+
+// openError returns the error of a scrape failed by the open breaker
+func (b *circuitBreaker) openError() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return errBreakerOpen{failures: b.failures, probe: b.opened.Add(b.probeInterval)}
+}
@@ -0,0 +1,143 @@
+package jolokia
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := newRetryPolicy(RetryConfig{MinBackoff: Duration(100 * time.Millisecond), MaxBackoff: Duration(time.Second)})
+
+	expected := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, max := range expected {
+		max *= time.Millisecond
+
+		for j := 0; j < 10; j++ {
+			if backoff := p.backoff(i + 1); backoff < max/2 || backoff > max {
+				t.Errorf("Expected backoff of retry %d between %s and %s, got %s", i+1, max/2, max, backoff)
+			}
+		}
+	}
+}
+
+func TestClient_ScrapeRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		status     int
+		timeout    time.Duration
+		minBackoff time.Duration
+		requests   int
+		retries    int
+		error      bool
+	}{
+		{"recovered", 2, http.StatusServiceUnavailable, 0, time.Millisecond, 3, 2, false},
+		{"exhausted", 5, http.StatusServiceUnavailable, 0, time.Millisecond, 4, 3, true},
+		{"not retryable", 1, http.StatusUnauthorized, 0, time.Millisecond, 1, 0, true},
+		{"deadline", 1, http.StatusServiceUnavailable, 50 * time.Millisecond, 10 * time.Second, 1, 0, true},
+		{"default deadline", 1, http.StatusServiceUnavailable, 0, 20 * time.Second, 1, 0, true},
+	}
+
+	for _, test := range tests {
+		agent := newTestAgent(nil)
+		agent.FailRequests(test.failures, test.status)
+		srv := httptest.NewServer(agent)
+
+		config := *expectedConfig
+		config.ScrapeTimeout = Duration(test.timeout)
+		config.Retry = RetryConfig{MaxRetries: 3, MinBackoff: Duration(test.minBackoff), MaxBackoff: Duration(test.minBackoff)}
+
+		client, err := NewClient(ClientOptions{Config: &config, Namespace: Namespace, Target: TargetConfig{URL: srv.URL}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := client.Scrape(context.Background())
+		srv.Close()
+
+		if test.error && err == nil {
+			t.Errorf("%s: expected the scrape to fail", test.name)
+		} else if !test.error && err != nil {
+			t.Errorf("%s: expected the scrape to succeed, got %v", test.name, err)
+		}
+
+		if agent.Requests() != test.requests || result.Retries != test.retries {
+			t.Errorf("%s: expected %d requests and %d retries, got %d and %d", test.name, test.requests, test.retries, agent.Requests(), result.Retries)
+		}
+	}
+}
+
+func TestClient_ScrapeCircuitBreaker(t *testing.T) {
+	agent := newTestAgent(nil)
+	agent.FailRequests(-1, http.StatusServiceUnavailable)
+	srv := httptest.NewServer(agent)
+	defer srv.Close()
+
+	config := *expectedConfig
+	config.CircuitBreaker = CircuitBreakerConfig{FailureThreshold: 2, ProbeInterval: Duration(time.Hour)}
+
+	client, err := NewClient(ClientOptions{Config: &config, Namespace: Namespace, Target: TargetConfig{URL: srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scrape := func(state, requests int) error {
+		_, err := client.Scrape(context.Background())
+
+		if client.breaker.State() != state {
+			t.Errorf("Expected breaker state %d, got %d", state, client.breaker.State())
+		}
+		if agent.Requests() != requests {
+			t.Errorf("Expected %d requests, got %d", requests, agent.Requests())
+		}
+
+		return err
+	}
+
+	scrape(breakerClosed, 1)
+	scrape(breakerOpen, 2)
+
+	if err := scrape(breakerOpen, 2); err == nil {
+		t.Error("Expected an open breaker to fail the scrape")
+	} else if _, ok := err.(errBreakerOpen); !ok {
+		t.Errorf("Expected the error of an open breaker, got %v", err)
+	}
+
+	// a failed probe opens the breaker again
+	client.breaker.opened = time.Now().Add(-time.Hour)
+	scrape(breakerOpen, 3)
+	scrape(breakerOpen, 3)
+
+	client.breaker.opened = time.Now().Add(-time.Hour)
+	agent.FailRequests(0, 0)
+	if err := scrape(breakerClosed, 4); err != nil {
+		t.Errorf("Expected a successful probe to close the breaker, got %v", err)
+	}
+}
+
+func TestConfigValidateRetry(t *testing.T) {
+	config := &Config{
+		ScrapeTimeout:  Duration(-time.Second),
+		Retry:          RetryConfig{MaxRetries: -1, MinBackoff: Duration(time.Second), MaxBackoff: Duration(time.Millisecond)},
+		CircuitBreaker: CircuitBreakerConfig{FailureThreshold: -1, ProbeInterval: Duration(-time.Second)},
+	}
+
+	errs, ok := config.Validate().(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected validation errors, got %v", config.Validate())
+	}
+
+	expected := []string{"scrapeTimeout", "retry.maxRetries", "retry.maxBackoff", "circuitBreaker.failureThreshold", "circuitBreaker.probeInterval"}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %v", len(expected), errs)
+	}
+
+	for i, path := range expected {
+		if errs[i].Path != path {
+			t.Errorf("Expected an error of %s, got %v", path, errs[i])
+		}
+	}
+}
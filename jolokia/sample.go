@@ -0,0 +1,49 @@
+package jolokia
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A Sample is a single value collected from a jolokia endpoint. Samples of metric mappings
+// refer to their mapping and the mbean the value was read from. TargetLabels are the labels
+// of the target the sample was collected from, Labels include them.
+type Sample struct {
+	Name         string
+	Help         string
+	Labels       map[string]string
+	TargetLabels map[string]string
+	Endpoint     string
+	Mbean        string
+	Mapping      *MetricMapping
+	Type         prometheus.ValueType
+	Value        float64
+	Timestamp    time.Time
+
+	// desc is the cached descriptor of the sample, built for descName
+	desc     *prometheus.Desc
+	descName string
+}
+
+// A SampleSource collects samples, e.g. an Exporter or Targets
+type SampleSource interface {
+	Samples() []Sample
+}
+
+// Metric returns the sample as prometheus metric. Samples of a client use the descriptor
+// cached for their name, unless the name was changed since.
+func (s Sample) Metric() prometheus.Metric {
+	desc := s.desc
+	if desc == nil || s.descName != s.Name {
+		desc = prometheus.NewDesc(s.Name, s.Help, nil, s.Labels)
+	}
+
+	return prometheus.MustNewConstMetric(desc, s.Type, s.Value)
+}
+
+// setDesc sets the cached descriptor of the sample, it has to match name, help and labels
+func (s *Sample) setDesc(desc *prometheus.Desc) {
+	s.desc = desc
+	s.descName = s.Name
+}
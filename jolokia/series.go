@@ -0,0 +1,141 @@
+package jolokia
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// A Series is a metric name with its labels, written like name{label="value"}, and its value
+type Series struct {
+	Name  string
+	Value float64
+}
+
+func (s Series) String() string {
+	return fmt.Sprintf("%s %v", s.Name, s.Value)
+}
+
+// A ChangedSeries has a different value than expected
+type ChangedSeries struct {
+	Name     string
+	Expected float64
+	Actual   float64
+}
+
+func (s ChangedSeries) String() string {
+	return fmt.Sprintf("%s expected %v, got %v", s.Name, s.Expected, s.Actual)
+}
+
+// SeriesDiff lists the differences between expected and actual series, sorted by name
+type SeriesDiff struct {
+	Missing []Series
+	Extra   []Series
+	Changed []ChangedSeries
+}
+
+// Empty tells whether the series are equal
+func (d SeriesDiff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Changed) == 0
+}
+
+// ReadSeries reads the series of a file in the prometheus text format. Only gauges,
+// counters and untyped metrics are supported, as they are the only ones exported.
+func ReadSeries(r io.Reader) (map[string]float64, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return nil, err
+	}
+
+	series := make(map[string]float64)
+	for name, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string, len(metric.GetLabel()))
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+
+			var value float64
+			switch family.GetType() {
+			case dto.MetricType_GAUGE:
+				value = metric.GetGauge().GetValue()
+			case dto.MetricType_COUNTER:
+				value = metric.GetCounter().GetValue()
+			case dto.MetricType_UNTYPED:
+				value = metric.GetUntyped().GetValue()
+			default:
+				return nil, fmt.Errorf("unsupported type %s of metric %s", family.GetType(), name)
+			}
+
+			series[seriesName(name, labels)] = value
+		}
+	}
+
+	return series, nil
+}
+
+// SampleSeries returns the series of the samples
+func SampleSeries(samples []Sample) map[string]float64 {
+	series := make(map[string]float64, len(samples))
+	for _, s := range samples {
+		series[seriesName(s.Name, s.Labels)] = s.Value
+	}
+
+	return series
+}
+
+// DiffSeries compares the actual series to the expected ones
+func DiffSeries(expected, actual map[string]float64) SeriesDiff {
+	diff := SeriesDiff{
+		Missing: make([]Series, 0),
+		Extra:   make([]Series, 0),
+		Changed: make([]ChangedSeries, 0),
+	}
+
+	for name, value := range expected {
+		actualValue, ok := actual[name]
+		if !ok {
+			diff.Missing = append(diff.Missing, Series{Name: name, Value: value})
+		} else if actualValue != value && !(math.IsNaN(actualValue) && math.IsNaN(value)) {
+			diff.Changed = append(diff.Changed, ChangedSeries{Name: name, Expected: value, Actual: actualValue})
+		}
+	}
+
+	for name, value := range actual {
+		if _, ok := expected[name]; !ok {
+			diff.Extra = append(diff.Extra, Series{Name: name, Value: value})
+		}
+	}
+
+	sort.Slice(diff.Missing, func(i, j int) bool { return diff.Missing[i].Name < diff.Missing[j].Name })
+	sort.Slice(diff.Extra, func(i, j int) bool { return diff.Extra[i].Name < diff.Extra[j].Name })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Name < diff.Changed[j].Name })
+
+	return diff
+}
+
+// seriesName returns the name of a series with its labels sorted by name
+func seriesName(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	names := make([]string, 0, len(labels))
+	for label := range labels {
+		names = append(names, label)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, label := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", label, labels[label]))
+	}
+
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
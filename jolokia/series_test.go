@@ -0,0 +1,70 @@
+package jolokia
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClient_ScrapeResponse(t *testing.T) {
+	client, err := NewClient(ClientOptions{Config: expectedConfig, Namespace: Namespace, Target: TargetConfig{URL: "http://test/test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := ioutil.ReadFile(path.Join("fixtures", "response.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.ScrapeResponse(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path.Join("fixtures", "metrics.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	expected, err := ReadSeries(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := DiffSeries(expected, SampleSeries(result.Samples)); !diff.Empty() {
+		t.Errorf("Expected the recorded response to produce metrics.txt, got %+v", diff)
+	}
+}
+
+func TestDiffSeries(t *testing.T) {
+	expected, err := ReadSeries(strings.NewReader(`
+# TYPE jolokia_heap_used gauge
+jolokia_heap_used{target="app-1"} 100
+jolokia_heap_used{target="app-2"} 200
+jolokia_thread_count 42
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := DiffSeries(expected, SampleSeries([]Sample{
+		{Name: "jolokia_heap_used", Labels: map[string]string{"target": "app-1"}, Value: 150},
+		{Name: "jolokia_thread_count", Value: 42},
+		{Name: "jolokia_gc_count", Value: 3},
+	}))
+
+	expectedDiff := SeriesDiff{
+		Missing: []Series{{Name: `jolokia_heap_used{target="app-2"}`, Value: 200}},
+		Extra:   []Series{{Name: "jolokia_gc_count", Value: 3}},
+		Changed: []ChangedSeries{{Name: `jolokia_heap_used{target="app-1"}`, Expected: 100, Actual: 150}},
+	}
+
+	if !reflect.DeepEqual(diff, expectedDiff) {
+		t.Errorf("Expected diff %+v, got %+v", expectedDiff, diff)
+	}
+}
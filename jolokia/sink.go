@@ -0,0 +1,175 @@
+package jolokia
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+const (
+	defaultSinkTimeout = 10 * time.Second
+
+	// maxUDPPacketSize keeps udp packets below the usual MTU so they aren't fragmented
+	maxUDPPacketSize = 1400
+)
+
+// lineFormat appends samples in the line based format of a sink
+type lineFormat interface {
+	// appendLine appends the sample as a single line, samples that can't be represented
+	// in the format are skipped
+	appendLine(b []byte, s Sample) []byte
+}
+
+// Sink collects samples in an interval and writes them to a Graphite or InfluxDB endpoint
+// over tcp or udp. Broken connections are reestablished on the next write.
+type Sink struct {
+	logger log.Logger
+	config SinkConfig
+	source SampleSource
+	format lineFormat
+
+	mutex sync.Mutex
+	conn  net.Conn
+}
+
+// NewSink returns a Sink writing the samples of the given source
+func NewSink(logger log.Logger, config SinkConfig, source SampleSource) (*Sink, error) {
+	var format lineFormat
+	switch config.Type {
+	case SinkTypeGraphite:
+		format = graphiteFormat{prefix: config.Prefix}
+	case SinkTypeInflux:
+		format = influxFormat{}
+	default:
+		return nil, fmt.Errorf("unknown sink type %q, expected %s or %s", config.Type, SinkTypeGraphite, SinkTypeInflux)
+	}
+
+	switch config.Protocol {
+	case "":
+		config.Protocol = "tcp"
+	case "tcp", "udp":
+	default:
+		return nil, fmt.Errorf("unknown protocol %q of sink %s, expected tcp or udp", config.Protocol, config.Address)
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = Duration(defaultPushInterval)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = Duration(defaultSinkTimeout)
+	}
+
+	return &Sink{
+		logger: logger,
+		config: config,
+		source: source,
+		format: format,
+	}, nil
+}
+
+// Run writes the samples in the configured interval until stop is closed
+func (s *Sink) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(s.config.Interval))
+	defer ticker.Stop()
+
+	for {
+		if err := s.Write(); err != nil {
+			s.logger.Errorf("Error writing samples to %s: %v", s.config.Address, err)
+		}
+
+		select {
+		case <-stop:
+			s.Close()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Write collects the samples and writes them to the endpoint
+func (s *Sink) Write() error {
+	packets := s.packets(s.source.Samples())
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, packet := range packets {
+		if err := s.write(packet); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close closes the connection to the endpoint
+func (s *Sink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// packets formats the samples and splits them into packets small enough for udp. Over tcp
+// all samples are written at once.
+func (s *Sink) packets(samples []Sample) [][]byte {
+	packets := make([][]byte, 0)
+
+	var packet []byte
+	for _, sample := range samples {
+		line := s.format.appendLine(nil, sample)
+		if s.config.Protocol == "udp" && len(packet) > 0 && len(packet)+len(line) > maxUDPPacketSize {
+			packets = append(packets, packet)
+			packet = nil
+		}
+
+		packet = append(packet, line...)
+	}
+
+	if len(packet) > 0 {
+		packets = append(packets, packet)
+	}
+
+	return packets
+}
+
+// write writes a packet, connecting to the endpoint if there is no connection. If writing
+// fails on an existing connection, it's reestablished and the packet is written again.
+func (s *Sink) write(packet []byte) error {
+	for try := 0; ; try++ {
+		reconnected := s.conn == nil
+		if reconnected {
+			conn, err := net.DialTimeout(s.config.Protocol, s.config.Address, time.Duration(s.config.Timeout))
+			if err != nil {
+				return err
+			}
+
+			s.logger.Debugf("Connected to %s://%s", s.config.Protocol, s.config.Address)
+			s.conn = conn
+		}
+
+		s.conn.SetWriteDeadline(time.Now().Add(time.Duration(s.config.Timeout)))
+		_, err := s.conn.Write(packet)
+		if err == nil {
+			return nil
+		}
+
+		s.conn.Close()
+		s.conn = nil
+
+		if reconnected || try > 0 {
+			return err
+		}
+
+		s.logger.Debugf("Reconnecting to %s://%s: %v", s.config.Protocol, s.config.Address, err)
+	}
+}
@@ -0,0 +1,207 @@
+package jolokia
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+var sinkSamples = staticSamples{
+	{
+		Name:      "jolokia_java_threading_thread_count",
+		Labels:    map[string]string{"target": "app-1", "env": "prod"},
+		Mbean:     "java.lang:type=Threading",
+		Value:     421,
+		Timestamp: time.Unix(1520000000, 0),
+	},
+	{
+		Name:      "jolokia_java_gc_java_lang_name_g1_young_generation_type_garbage_collector_collection_count",
+		Labels:    map[string]string{"target": "app-1", "env": "prod"},
+		Mbean:     "java.lang:name=G1 Young Generation,type=GarbageCollector",
+		Value:     12,
+		Timestamp: time.Unix(1520000000, 0),
+	},
+}
+
+func TestSink_GraphiteTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	lines := make(chan string, 10)
+	go acceptLines(listener, lines, false)
+
+	sink, err := NewSink(log.Base(), SinkConfig{
+		Type:    SinkTypeGraphite,
+		Address: listener.Addr().String(),
+		Prefix:  "jmx.",
+	}, sinkSamples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"jmx.env.prod.target.app-1.jolokia_java_threading_thread_count 421 1520000000",
+		"jmx.env.prod.target.app-1.jolokia_java_gc_java_lang_name_g1_young_generation_type_garbage_collector_collection_count 12 1520000000",
+	}
+
+	for _, line := range expected {
+		if got := receiveLine(t, lines); got != line {
+			t.Errorf("Expected line %q, got %q", line, got)
+		}
+	}
+}
+
+func TestGraphiteFormat_AppendLine(t *testing.T) {
+	format := graphiteFormat{prefix: "jmx.my app."}
+
+	line := format.appendLine(nil, Sample{
+		Name:      "jolokia_java_gc_collection_count",
+		Labels:    map[string]string{"target": "10.0.0.1:8778", "collector": "G1 Young Generation", "env": ""},
+		Value:     12,
+		Timestamp: time.Unix(1520000000, 0),
+	})
+
+	expected := "jmx.my_app.collector.G1_Young_Generation.env._.target.10_0_0_1_8778.jolokia_java_gc_collection_count 12 1520000000\n"
+	if string(line) != expected {
+		t.Errorf("Expected line %q, got %q", expected, line)
+	}
+
+	// series with different label names but the same values get different paths
+	a := format.appendLine(nil, Sample{Name: "up", Labels: map[string]string{"a": "x"}, Timestamp: time.Unix(1520000000, 0)})
+	b := format.appendLine(nil, Sample{Name: "up", Labels: map[string]string{"b": "x"}, Timestamp: time.Unix(1520000000, 0)})
+	if bytes.Equal(a, b) {
+		t.Errorf("Expected different paths for different label sets, got %q", a)
+	}
+}
+
+func TestSink_InfluxUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink, err := NewSink(log.Base(), SinkConfig{
+		Type:     SinkTypeInflux,
+		Address:  conn.LocalAddr().String(),
+		Protocol: "udp",
+	}, sinkSamples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, maxUDPPacketSize)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "jolokia_java_threading_thread_count,env=prod,target=app-1,type=Threading value=421 1520000000000000000\n" +
+		"jolokia_java_gc_java_lang_name_g1_young_generation_type_garbage_collector_collection_count," +
+		`env=prod,name=G1\ Young\ Generation,target=app-1,type=GarbageCollector value=12 1520000000000000000` + "\n"
+
+	if string(buf[:n]) != expected {
+		t.Errorf("Expected packet %q, got %q", expected, buf[:n])
+	}
+}
+
+func TestSink_Reconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	lines := make(chan string, 100)
+	go acceptLines(listener, lines, true)
+
+	buf := bytes.NewBufferString("")
+	logger := log.NewLogger(buf)
+	logger.SetLevel("warn")
+
+	sink, err := NewSink(logger, SinkConfig{
+		Type:    SinkTypeGraphite,
+		Address: listener.Addr().String(),
+	}, sinkSamples[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	// the first connection is closed by the server after the first line, writes on the
+	// broken connection fail eventually and have to reconnect
+	received := 0
+	for try := 0; try < 50 && received < 2; try++ {
+		if err := sink.Write(); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case <-lines:
+			received++
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	if received < 2 {
+		t.Errorf("Expected lines to be received after reconnecting, got %d", received)
+	}
+}
+
+func TestNewSink_UnknownType(t *testing.T) {
+	if _, err := NewSink(log.Base(), SinkConfig{Type: "opentsdb", Address: "localhost:4242"}, sinkSamples); err == nil {
+		t.Error("Expected an error for an unknown sink type")
+	}
+}
+
+// acceptLines sends the lines received on all connections to the channel. With closeFirst
+// the first connection is closed after its first line.
+func acceptLines(listener net.Listener, lines chan<- string, closeFirst bool) {
+	for first := true; ; first = false {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func(conn net.Conn, closeAfterLine bool) {
+			defer conn.Close()
+
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				lines <- strings.TrimSpace(scanner.Text())
+				if closeAfterLine {
+					return
+				}
+			}
+		}(conn, first && closeFirst)
+	}
+}
+
+func receiveLine(t *testing.T, lines <-chan string) string {
+	select {
+	case line := <-lines:
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for line")
+		return ""
+	}
+}
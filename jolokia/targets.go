@@ -0,0 +1,225 @@
+package jolokia
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+const staticTargetsSource = "static"
+
+// Targets exports the metrics of multiple jolokia endpoints. Targets are grouped by the
+// source they were configured or discovered by, every source can be updated on its own.
+// Target names are unique across sources, a target is kept by the source that added it
+// first. As every target may carry different labels, Targets is an unchecked collector
+// and does not describe its metrics.
+type Targets struct {
+	logger    log.Logger
+	config    *Config
+	namespace string
+	transport http.RoundTripper
+
+	mutex   sync.RWMutex
+	sources map[string]map[string]*targetExporter
+
+	conflicts     float64
+	conflictsDesc *prometheus.Desc
+}
+
+type targetExporter struct {
+	target   TargetConfig
+	exporter *Exporter
+}
+
+// NewTargets returns an exporter for every target of the config
+func NewTargets(logger log.Logger, config *Config, namespace string) (*Targets, error) {
+	return NewTargetsWithTransport(logger, config, namespace, nil)
+}
+
+// NewTargetsWithTransport returns Targets whose exporters send their requests with the
+// given transport, e.g. to replay a Recording
+func NewTargetsWithTransport(logger log.Logger, config *Config, namespace string, transport http.RoundTripper) (*Targets, error) {
+	targets := &Targets{
+		logger:    logger,
+		config:    config,
+		namespace: namespace,
+		transport: transport,
+		sources:   make(map[string]map[string]*targetExporter),
+		conflictsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "target_name_conflicts_total"),
+			"How often a target was ignored because another target of the same name was configured first",
+			nil,
+			nil),
+	}
+
+	if err := targets.Sync(staticTargetsSource, config.Targets); err != nil {
+		return nil, err
+	}
+
+	return targets, nil
+}
+
+// Sync replaces the targets of the given source. Exporters are created for new or changed
+// targets and retired for targets that are gone, unchanged targets keep their exporter.
+// If any exporter can't be created, the targets of the source are left untouched. Targets
+// whose name is already used by an earlier target of the source or by another source are
+// ignored and counted as conflicts.
+func (t *Targets) Sync(source string, targets []TargetConfig) error {
+	t.mutex.RLock()
+	current := t.sources[source]
+	t.mutex.RUnlock()
+
+	conflicts := 0
+	next := make(map[string]*targetExporter, len(targets))
+	for _, target := range targets {
+		name := targetName(target)
+
+		if _, ok := next[name]; ok {
+			t.logger.Warnf("Ignoring target %s from %s, it's configured more than once", name, source)
+			conflicts++
+			continue
+		}
+
+		if existing, ok := current[name]; ok && reflect.DeepEqual(existing.target, target) {
+			next[name] = existing
+			continue
+		}
+
+		exporter, err := newTargetExporter(t.logger, t.config, t.namespace, target, t.transport)
+		if err != nil {
+			return err
+		}
+
+		t.logger.Debugf("Adding target %s from %s", name, source)
+		next[name] = &targetExporter{target: target, exporter: exporter}
+	}
+
+	for name := range current {
+		if _, ok := next[name]; !ok {
+			t.logger.Debugf("Removing target %s from %s", name, source)
+		}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for name := range next {
+		if owner, ok := t.owner(name, source); ok {
+			t.logger.Warnf("Ignoring target %s from %s, a target of that name is already configured by %s", name, source, owner)
+			conflicts++
+			delete(next, name)
+		}
+	}
+	t.conflicts += float64(conflicts)
+
+	if len(next) == 0 {
+		delete(t.sources, source)
+	} else {
+		t.sources[source] = next
+	}
+
+	return nil
+}
+
+// owner returns the source other than the given one that has a target of the given name,
+// the mutex has to be held
+func (t *Targets) owner(name, source string) (string, bool) {
+	for other, targets := range t.sources {
+		if _, ok := targets[name]; ok && other != source {
+			return other, true
+		}
+	}
+
+	return "", false
+}
+
+// Exporters returns the exporters of all targets, ordered by source and target name
+func (t *Targets) Exporters() []*Exporter {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	sources := make([]string, 0, len(t.sources))
+	for source := range t.sources {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	exporters := make([]*Exporter, 0)
+	for _, source := range sources {
+		names := make([]string, 0, len(t.sources[source]))
+		for name := range t.sources[source] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			exporters = append(exporters, t.sources[source][name].exporter)
+		}
+	}
+
+	return exporters
+}
+
+// Describe implements prometheus.Collector.
+func (t *Targets) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect scrapes all targets concurrently, implements prometheus.Collector.
+func (t *Targets) Collect(ch chan<- prometheus.Metric) {
+	exporters := t.Exporters()
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(exporters))
+
+	for _, exporter := range exporters {
+		go func(e *Exporter) {
+			defer wg.Done()
+			e.Collect(ch)
+		}(exporter)
+	}
+
+	wg.Wait()
+
+	t.mutex.RLock()
+	conflicts := t.conflicts
+	t.mutex.RUnlock()
+
+	ch <- prometheus.MustNewConstMetric(t.conflictsDesc, prometheus.CounterValue, conflicts)
+}
+
+// Samples scrapes all targets concurrently and returns their samples
+func (t *Targets) Samples() []Sample {
+	exporters := t.Exporters()
+
+	mutex := sync.Mutex{}
+	samples := make([]Sample, 0)
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(exporters))
+
+	for _, exporter := range exporters {
+		go func(e *Exporter) {
+			defer wg.Done()
+
+			s := e.Samples()
+			mutex.Lock()
+			samples = append(samples, s...)
+			mutex.Unlock()
+		}(exporter)
+	}
+
+	wg.Wait()
+	return samples
+}
+
+// targetName returns the name of the target that is used as target label
+func targetName(target TargetConfig) string {
+	if target.Name == "" {
+		return target.URL
+	}
+
+	return target.Name
+}
@@ -0,0 +1,143 @@
+package jolokia
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/log"
+)
+
+func TestTargets_Collect(t *testing.T) {
+	buf := bytes.NewBufferString("")
+	logger := log.NewLogger(buf)
+	logger.SetLevel("warn")
+
+	fixtureSrv := httptest.NewServer(http.HandlerFunc(authTestHandler))
+	defer fixtureSrv.Close()
+
+	config := &Config{
+		Modules: map[string]Module{
+			"threads": {Metrics: expectedConfig.Metrics[2:3]},
+		},
+		Targets: []TargetConfig{
+			{
+				Name:      "app",
+				URL:       fixtureSrv.URL,
+				BasicAuth: &BasicAuth{Username: "admin", Password: "secret"},
+				Labels:    map[string]string{"env": "test"},
+				Module:    "threads",
+			},
+			{
+				Name:   "broken",
+				URL:    fixtureSrv.URL,
+				Module: "threads",
+			},
+		},
+	}
+
+	targets, err := NewTargets(logger, config, Namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(targets)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rw := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(rw, req)
+
+	resBody := rw.Body.String()
+	for _, expected := range []string{
+		`jolokia_up{env="test",target="app"} 1`,
+		`jolokia_java_threading_thread_count{env="test",target="app"} 421`,
+		`jolokia_up{target="broken"} 1`,
+	} {
+		if !strings.Contains(resBody, expected) {
+			t.Errorf("expected body to contain %s, but doesn't: %s", expected, resBody)
+		}
+	}
+
+	if strings.Contains(resBody, `jolokia_java_threading_thread_count{target="broken"}`) {
+		t.Errorf("expected body not to contain metrics of unauthorized target: %s", resBody)
+	}
+}
+
+func TestTargets_Sync(t *testing.T) {
+	targets, err := NewTargets(log.Base(), expectedConfig, Namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := TargetConfig{Name: "app", URL: "http://app/jolokia"}
+	if err := targets.Sync("test", []TargetConfig{app}); err != nil {
+		t.Fatal(err)
+	}
+	exporter := targets.Exporters()[0]
+
+	other := TargetConfig{Name: "other", URL: "http://other/jolokia"}
+	if err := targets.Sync("test", []TargetConfig{app, other}); err != nil {
+		t.Fatal(err)
+	}
+
+	exporters := targets.Exporters()
+	if len(exporters) != 2 {
+		t.Fatalf("Expected 2 targets, got %d", len(exporters))
+	}
+	if exporters[0] != exporter {
+		t.Error("Expected exporter of unchanged target to be kept")
+	}
+
+	if err := targets.Sync("test", []TargetConfig{{Name: "broken", URL: "http://broken", Module: "missing"}}); err == nil {
+		t.Fatal("Expected error syncing target with unknown module")
+	}
+	if len(targets.Exporters()) != 2 {
+		t.Error("Expected targets to be left untouched after failed sync")
+	}
+
+	if err := targets.Sync("test", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(targets.Exporters()) != 0 {
+		t.Error("Expected all targets to be removed")
+	}
+}
+
+func TestTargets_SyncConflicts(t *testing.T) {
+	targets, err := NewTargets(log.Base(), expectedConfig, Namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := TargetConfig{Name: "app", URL: "http://app/jolokia"}
+	if err := targets.Sync("first", []TargetConfig{app, {Name: "app", URL: "http://other/jolokia"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := targets.Sync("second", []TargetConfig{{Name: "app", URL: "http://second/jolokia"}, {Name: "db", URL: "http://db/jolokia"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	exporters := targets.Exporters()
+	if len(exporters) != 2 || exporters[0].URI != app.URL || exporters[1].URI != "http://db/jolokia" {
+		t.Fatalf("Expected the first target named app and db, got %d targets", len(exporters))
+	}
+	if targets.conflicts != 2 {
+		t.Errorf("Expected 2 conflicts, got %v", targets.conflicts)
+	}
+
+	// the name is free once its first source drops it
+	if err := targets.Sync("first", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := targets.Sync("second", []TargetConfig{{Name: "app", URL: "http://second/jolokia"}}); err != nil {
+		t.Fatal(err)
+	}
+	if exporters := targets.Exporters(); len(exporters) != 1 || exporters[0].URI != "http://second/jolokia" {
+		t.Errorf("Expected the target of the second source, got %d targets", len(exporters))
+	}
+}
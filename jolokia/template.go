@@ -0,0 +1,203 @@
+package jolokia
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Template references, besides the captures ${1}, ${2}, ... of regular expression include
+// patterns. They all contain a dot or digit, so the expansion of environment variables in
+// config files leaves them alone.
+const (
+	templateMbeanPrefix = "mbean."
+	templateAttribute   = "value.attribute"
+	templateKey         = "value.key"
+)
+
+// A nameTemplate is a metric name or label value referring to the values it's rendered
+// for with ${...}: ${mbean.name} is the name key property of the mbean of a value,
+// ${value.attribute} its attribute, ${value.key} the keys below the attribute joined with
+// underscores and ${1} the first capture of the regular expression include pattern
+// matching its key path.
+type nameTemplate struct {
+	parts []templatePart
+}
+
+// A templatePart is a literal or, if ref is set, a reference
+type templatePart struct {
+	literal string
+	ref     string
+}
+
+// A templateValue holds what the references of a template are rendered to
+type templateValue struct {
+	properties map[string]string
+	attribute  string
+	keys       []string
+	captures   []string
+}
+
+// isTemplate tells whether a target or label value contains references
+func isTemplate(s string) bool {
+	return strings.Contains(s, "${")
+}
+
+func parseTemplate(s string) (*nameTemplate, error) {
+	t := &nameTemplate{}
+
+	for s != "" {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			t.parts = append(t.parts, templatePart{literal: s})
+			break
+		}
+		if start > 0 {
+			t.parts = append(t.parts, templatePart{literal: s[:start]})
+		}
+
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated reference %q", s[start:])
+		}
+
+		ref := s[start+2 : start+end]
+		if err := validateReference(ref); err != nil {
+			return nil, err
+		}
+
+		t.parts = append(t.parts, templatePart{ref: ref})
+		s = s[start+end+1:]
+	}
+
+	return t, nil
+}
+
+func validateReference(ref string) error {
+	switch {
+	case ref == templateAttribute, ref == templateKey:
+		return nil
+	case strings.HasPrefix(ref, templateMbeanPrefix) && len(ref) > len(templateMbeanPrefix):
+		return nil
+	}
+
+	if n, err := strconv.Atoi(ref); err == nil && n > 0 {
+		return nil
+	}
+
+	return fmt.Errorf("unknown reference ${%s}, expected ${%s<property>}, ${%s}, ${%s} or a capture like ${1}", ref, templateMbeanPrefix, templateAttribute, templateKey)
+}
+
+// maxCapture returns the highest capture the template refers to
+func (t *nameTemplate) maxCapture() int {
+	max := 0
+	for _, part := range t.parts {
+		if n, err := strconv.Atoi(part.ref); err == nil && n > max {
+			max = n
+		}
+	}
+
+	return max
+}
+
+// render renders the template, each reference is passed to the escape function
+func (t *nameTemplate) render(v templateValue, escape func(string) string) string {
+	if len(t.parts) == 1 && t.parts[0].ref == "" {
+		return t.parts[0].literal
+	}
+
+	rendered := ""
+	for _, part := range t.parts {
+		if part.ref == "" {
+			rendered += part.literal
+		} else {
+			rendered += escape(v.lookup(part.ref))
+		}
+	}
+
+	return rendered
+}
+
+func (v templateValue) lookup(ref string) string {
+	switch {
+	case ref == templateAttribute:
+		return v.attribute
+	case ref == templateKey:
+		return strings.Join(v.keys, "_")
+	case strings.HasPrefix(ref, templateMbeanPrefix):
+		return v.properties[ref[len(templateMbeanPrefix):]]
+	}
+
+	if n, err := strconv.Atoi(ref); err == nil && n < len(v.captures) {
+		return v.captures[n]
+	}
+
+	return ""
+}
+
+// renderName renders a metric name, the referenced values are sanitized like the keys of
+// flattened values and repeated underscores are collapsed
+func (t *nameTemplate) renderName(v templateValue) string {
+	name := t.render(v, sanitize)
+	return strings.Trim(underscoreRegExp.ReplaceAllString(name, "_"), "_")
+}
+
+// renderLabel renders a label value, the referenced values are used as they are
+func (t *nameTemplate) renderLabel(v templateValue) string {
+	return t.render(v, func(s string) string { return s })
+}
+
+// validName tells whether the literal parts of a target template form a valid metric name
+func (t *nameTemplate) validName() bool {
+	name := t.render(templateValue{}, func(string) string { return "x" })
+	return metricNameRegExp.MatchString(name)
+}
+
+// mappingTemplates holds the parsed target and label templates of a mapping. If the target
+// contains references, it's the full name of the values instead of the prefix of their
+// flattened keys. Otherwise it's nil and the keys are appended to the target as usual.
+type mappingTemplates struct {
+	target *nameTemplate
+	labels map[string]*nameTemplate
+}
+
+// hasTemplates tells whether the target or a label value of a mapping is a template
+func (m MetricMapping) hasTemplates() bool {
+	if isTemplate(m.Target) {
+		return true
+	}
+
+	for _, value := range m.Labels {
+		if isTemplate(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newMappingTemplates(m MetricMapping) (*mappingTemplates, error) {
+	if !isTemplate(m.Target) && len(m.Labels) == 0 {
+		return nil, nil
+	}
+
+	templates := &mappingTemplates{labels: make(map[string]*nameTemplate, len(m.Labels))}
+
+	if isTemplate(m.Target) {
+		t, err := parseTemplate(m.Target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target %q: %v", m.Target, err)
+		}
+		templates.target = t
+	}
+
+	for name, value := range m.Labels {
+		t, err := parseTemplate(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q of label %s of mapping %s: %v", value, name, m.Target, err)
+		}
+		templates.labels[name] = t
+	}
+
+	return templates, nil
+}
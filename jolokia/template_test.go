@@ -0,0 +1,171 @@
+package jolokia
+
+import (
+	"context"
+	"net/http/httptest"
+	"sort"
+	"testing"
+)
+
+func TestNameTemplate_Render(t *testing.T) {
+	v := templateValue{
+		properties: map[string]string{"type": "GarbageCollector", "name": "G1 Young Generation"},
+		attribute:  "HeapMemoryUsage",
+		keys:       []string{"usedBytes"},
+		captures:   []string{"ProcessCpuLoad", "Process"},
+	}
+
+	tests := []struct {
+		template string
+		name     string
+		label    string
+	}{
+		{"gc_${mbean.name}_collections", "gc_g_1_young_generation_collections", "gc_G1 Young Generation_collections"},
+		{"memory_${value.key}", "memory_used_bytes", "memory_usedBytes"},
+		{"${value.attribute}", "heap_memory_usage", "HeapMemoryUsage"},
+		{"cpu_${1}_load", "cpu_process_load", "cpu_Process_load"},
+		{"cpu_${mbean.unknown}_${2}_load", "cpu_load", "cpu___load"},
+		{"plain", "plain", "plain"},
+	}
+
+	for _, test := range tests {
+		tmpl, err := parseTemplate(test.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if name := tmpl.renderName(v); name != test.name {
+			t.Errorf("Expected %s to render name %q, got %q", test.template, test.name, name)
+		}
+		if label := tmpl.renderLabel(v); label != test.label {
+			t.Errorf("Expected %s to render label %q, got %q", test.template, test.label, label)
+		}
+	}
+
+	for _, template := range []string{"gc_${name}", "gc_${mbean.}", "gc_${0}", "gc_${mbean.name"} {
+		if _, err := parseTemplate(template); err == nil {
+			t.Errorf("Expected template %q to be invalid", template)
+		}
+	}
+}
+
+func TestClient_ScrapeTemplates(t *testing.T) {
+	srv := httptest.NewServer(newTestAgent(nil))
+	defer srv.Close()
+
+	config := &Config{
+		Metrics: []MetricMapping{
+			{
+				Source: MetricSource{Mbean: "java.lang:type=GarbageCollector,name=*", Attribute: "CollectionCount"},
+				Target: "jvm_gc_${value.attribute}",
+				Labels: map[string]string{"collector": "${mbean.name}"},
+			},
+			{
+				Source: MetricSource{Mbean: "java.lang:type=Memory", Attribute: "HeapMemoryUsage"},
+				Target: "jvm_heap_${value.key}_bytes",
+			},
+			{
+				// the keys are appended to a target that isn't a template
+				Source: MetricSource{Mbean: "java.lang:type=Memory", Attribute: "HeapMemoryUsage"},
+				Target: "heap",
+				Labels: map[string]string{"type": "${mbean.type}"},
+			},
+			{
+				Source:  MetricSource{Mbean: "java.lang:type=OperatingSystem"},
+				Target:  "os_cpu_load",
+				Include: []string{"/(.*)CpuLoad/"},
+				Labels:  map[string]string{"scope": "${1}"},
+			},
+		},
+	}
+
+	client, err := NewClient(ClientOptions{Config: config, Namespace: Namespace, Labels: map[string]string{targetLabel: "app"}, Target: TargetConfig{URL: srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.Scrape(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) > 0 || len(result.Collisions) > 0 {
+		t.Errorf("Unexpected errors %v and collisions %v", result.Errors, result.Collisions)
+	}
+
+	series := make([]string, 0, len(result.Samples))
+	for _, s := range result.Samples {
+		series = append(series, seriesName(s.Name, s.Labels))
+	}
+	sort.Strings(series)
+
+	expected := []string{
+		`jolokia_heap_committed{target="app",type="Memory"}`,
+		`jolokia_heap_init{target="app",type="Memory"}`,
+		`jolokia_heap_max{target="app",type="Memory"}`,
+		`jolokia_heap_used{target="app",type="Memory"}`,
+		`jolokia_jvm_gc_collection_count{collector="G1 Old Generation",target="app"}`,
+		`jolokia_jvm_gc_collection_count{collector="G1 Young Generation",target="app"}`,
+		`jolokia_jvm_heap_committed_bytes{target="app"}`,
+		`jolokia_jvm_heap_init_bytes{target="app"}`,
+		`jolokia_jvm_heap_max_bytes{target="app"}`,
+		`jolokia_jvm_heap_used_bytes{target="app"}`,
+		`jolokia_os_cpu_load_process_cpu_load{scope="Process",target="app"}`,
+		`jolokia_os_cpu_load_system_cpu_load{scope="System",target="app"}`,
+	}
+
+	if len(series) != len(expected) {
+		t.Fatalf("Expected series %v, got %v", expected, series)
+	}
+	for i := range expected {
+		if series[i] != expected[i] {
+			t.Errorf("Expected series %s, got %s", expected[i], series[i])
+		}
+	}
+}
+
+func TestConfigValidateTemplates(t *testing.T) {
+	config := &Config{
+		Metrics: []MetricMapping{
+			{Source: MetricSource{Mbean: "java.lang:type=GarbageCollector,name=*"}, Target: "gc_${mbean.name}"},
+			{Source: MetricSource{Mbean: "java.lang:type=GarbageCollector,name=*"}, Target: "gc_${mbean.name}"},
+			{Source: MetricSource{Mbean: "java.lang:type=Memory"}, Target: "memory_${unknown}"},
+			{Source: MetricSource{Mbean: "java.lang:type=Threading"}, Target: "1_${value.key}"},
+			{Source: MetricSource{Mbean: "java.lang:type=OperatingSystem"}, Target: "os", Include: []string{"/(.*)CpuLoad/"}, Labels: map[string]string{"scope": "${1}", "kind": "${2}"}},
+			{Source: MetricSource{Mbean: "java.lang:type=Runtime"}, Target: "runtime", Labels: map[string]string{"target": "${mbean.type}"}},
+		},
+	}
+
+	errs, ok := config.Validate().(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected validation errors, got %v", config.Validate())
+	}
+
+	expected := []string{"metrics[1].source", "metrics[2].target", "metrics[3].target", "metrics[4].labels.kind", "metrics[5].labels.target"}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %v", len(expected), errs)
+	}
+
+	for i, path := range expected {
+		if errs[i].Path != path {
+			t.Errorf("Expected an error of %s, got %v", path, errs[i])
+		}
+	}
+}
+
+func TestLoadConfigTemplates(t *testing.T) {
+	config, err := loadConfigString(t, `metrics:
+- source:
+    mbean: java.lang:type=GarbageCollector,name=*
+    attribute: CollectionCount
+  target: gc_${mbean.name}_${value.key}
+  labels:
+    collector: ${mbean.name}
+`)
+	if err != nil {
+		t.Fatal("Error loading config file:", err)
+	}
+
+	if config.Metrics[0].Target != "gc_${mbean.name}_${value.key}" || config.Metrics[0].Labels["collector"] != "${mbean.name}" {
+		t.Errorf("Expected templates to be kept by the expansion of environment variables, got %v", config.Metrics[0])
+	}
+}
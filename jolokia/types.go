@@ -3,17 +3,97 @@ package jolokia
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 )
 
 // Config is holding a list of metrics that should be exported
 type Config struct {
+	Metrics []MetricMapping   `json:"metrics"`
+	Presets []string          `json:"presets,omitempty"`
+	Modules map[string]Module `json:"modules,omitempty"`
+	Targets []TargetConfig    `json:"targets,omitempty"`
+
+	// CollisionStrategy is one of CollisionFirst (default), CollisionLast or CollisionSuffix
+	CollisionStrategy string `json:"collisionStrategy,omitempty"`
+
+	// MaxResponseSize limits the size of jolokia responses in bytes, larger responses fail
+	// the scrape. There's no limit if it's 0.
+	MaxResponseSize int64 `json:"maxResponseSize,omitempty"`
+
+	// MaxSeries limits the number of series of a target, series over the limit are dropped.
+	// There's no limit if it's 0.
+	MaxSeries int `json:"maxSeries,omitempty"`
+
+	// ScrapeTimeout is the deadline of a scrape including its retries, 10s if it's 0
+	ScrapeTimeout  Duration             `json:"scrapeTimeout,omitempty"`
+	Retry          RetryConfig          `json:"retry"`
+	CircuitBreaker CircuitBreakerConfig `json:"circuitBreaker"`
+
+	FileSDConfigs []FileSDConfig `json:"fileSdConfigs,omitempty"`
+	HTTPSDConfigs []HTTPSDConfig `json:"httpSdConfigs,omitempty"`
+
+	RemoteWrite []RemoteWriteConfig `json:"remoteWrite,omitempty"`
+	OTLP        []OTLPConfig        `json:"otlp,omitempty"`
+	Sinks       []SinkConfig        `json:"sinks,omitempty"`
+
+	// lines of the settings in the config file, used to report validation errors
+	lines map[string]int
+}
+
+// A Module is a named list of metrics that targets can refer to instead of the
+// top level metrics
+type Module struct {
 	Metrics []MetricMapping `json:"metrics"`
+	Presets []string        `json:"presets,omitempty"`
+}
+
+// TargetConfig defines a jolokia endpoint that should be scraped
+type TargetConfig struct {
+	Name      string            `json:"name"`
+	URL       string            `json:"url"`
+	BasicAuth *BasicAuth        `json:"basicAuth,omitempty"`
+	TLS       TLSConfig         `json:"tls"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Module    string            `json:"module,omitempty"`
+}
+
+// BasicAuth holds the credentials used to authenticate on a jolokia endpoint
+type BasicAuth struct {
+	Username     string `json:"username"`
+	Password     string `json:"password,omitempty"`
+	PasswordFile string `json:"passwordFile,omitempty"`
+}
+
+// TLSConfig configures how https connections to a jolokia endpoint are established
+type TLSConfig struct {
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+	CAFile             string `json:"caFile,omitempty"`
+	CertFile           string `json:"certFile,omitempty"`
+	KeyFile            string `json:"keyFile,omitempty"`
+	ServerName         string `json:"serverName,omitempty"`
 }
 
-// A MetricMapping is the assignment of a JMX source path to a target prom key name
+// A MetricMapping is the assignment of a JMX source path to a target prom key name. The
+// type is one of MetricTypeGauge or MetricTypeCounter, metrics without type are untyped.
 type MetricMapping struct {
 	Source MetricSource `json:"source"`
-	Target string       `json:"target"`
+	// Target is the name of the metrics, the keys of nested values are appended unless it's
+	// a template like tomcat_${mbean.name}_requests, see nameTemplate
+	Target string `json:"target"`
+	Type   string `json:"type,omitempty"`
+	// Labels are added to the metrics of the mapping, their values may be templates
+	Labels map[string]string `json:"labels,omitempty"`
+	// Interval is the minimum time between two requests of the mapping, scrapes in
+	// between re-export its last samples. It's requested on every scrape if it's 0.
+	Interval Duration `json:"interval,omitempty"`
+	// MaxSeries limits the number of series of the mapping, e.g. of a mbean pattern,
+	// series over the limit are dropped. There's no limit if it's 0.
+	MaxSeries int `json:"maxSeries,omitempty"`
+	// Include and Exclude select the values of the mapping by their key path, e.g.
+	// HeapMemoryUsage/used, with globs or regular expressions enclosed in slashes
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
 }
 
 // MetricSource defines what path the metric should be load from
@@ -23,16 +103,196 @@ type MetricSource struct {
 	Path      string `json:"path"`
 }
 
-// RequestMetric holds the info for jolokia what to export
+// FileSDConfig discovers targets from files in the file_sd format of prometheus. The files
+// aren't watched, changes are picked up when they're re-read every RefreshInterval.
+type FileSDConfig struct {
+	Files           []string       `json:"files"`
+	RefreshInterval Duration       `json:"refreshInterval,omitempty"`
+	TargetDefaults  TargetDefaults `json:"targetDefaults"`
+}
+
+// HTTPSDConfig discovers targets from an endpoint serving target groups in the http_sd
+// format of prometheus. The credentials and tls settings are used for the discovery
+// endpoint, not for the discovered targets.
+type HTTPSDConfig struct {
+	URL             string         `json:"url"`
+	RefreshInterval Duration       `json:"refreshInterval,omitempty"`
+	BasicAuth       *BasicAuth     `json:"basicAuth,omitempty"`
+	TLS             TLSConfig      `json:"tls"`
+	TargetDefaults  TargetDefaults `json:"targetDefaults"`
+}
+
+// TargetDefaults are applied to all targets found by a service discovery
+type TargetDefaults struct {
+	Module    string            `json:"module,omitempty"`
+	BasicAuth *BasicAuth        `json:"basicAuth,omitempty"`
+	TLS       TLSConfig         `json:"tls"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// RemoteWriteConfig configures sending the collected samples to a prometheus remote_write receiver
+type RemoteWriteConfig struct {
+	URL            string            `json:"url"`
+	Interval       Duration          `json:"interval,omitempty"`
+	Timeout        Duration          `json:"timeout,omitempty"`
+	ExternalLabels map[string]string `json:"externalLabels,omitempty"`
+	BasicAuth      *BasicAuth        `json:"basicAuth,omitempty"`
+	TLS            TLSConfig         `json:"tls"`
+	Queue          QueueConfig       `json:"queue"`
+}
+
+// OTLPConfig configures pushing the collected samples to an OpenTelemetry collector
+// using OTLP/HTTP. The url is the full metrics endpoint, e.g. http://collector:4318/v1/metrics.
+type OTLPConfig struct {
+	URL                string            `json:"url"`
+	Interval           Duration          `json:"interval,omitempty"`
+	Timeout            Duration          `json:"timeout,omitempty"`
+	Headers            map[string]string `json:"headers,omitempty"`
+	ResourceAttributes map[string]string `json:"resourceAttributes,omitempty"`
+	BasicAuth          *BasicAuth        `json:"basicAuth,omitempty"`
+	TLS                TLSConfig         `json:"tls"`
+}
+
+// SinkConfig configures writing the collected samples to a Graphite or InfluxDB endpoint
+// in their line based formats. The type is one of SinkTypeGraphite or SinkTypeInflux, the
+// protocol tcp or udp. The prefix is prepended to the metric paths of Graphite.
+type SinkConfig struct {
+	Type     string   `json:"type"`
+	Address  string   `json:"address"`
+	Protocol string   `json:"protocol,omitempty"`
+	Interval Duration `json:"interval,omitempty"`
+	Timeout  Duration `json:"timeout,omitempty"`
+	Prefix   string   `json:"prefix,omitempty"`
+}
+
+// QueueConfig configures how many requests are queued and how failed requests are retried
+type QueueConfig struct {
+	Capacity   int      `json:"capacity,omitempty"`
+	MaxRetries int      `json:"maxRetries,omitempty"`
+	MinBackoff Duration `json:"minBackoff,omitempty"`
+	MaxBackoff Duration `json:"maxBackoff,omitempty"`
+}
+
+// RetryConfig configures how often a failed request of a scrape is retried. Requests are
+// retried after transport errors and responses with status 429 or 5xx, the backoff
+// doubles with every retry and is jittered. Failed requests are not retried by default.
+type RetryConfig struct {
+	MaxRetries int      `json:"maxRetries,omitempty"`
+	MinBackoff Duration `json:"minBackoff,omitempty"`
+	MaxBackoff Duration `json:"maxBackoff,omitempty"`
+}
+
+// CircuitBreakerConfig configures the circuit breaker of every target. After the given
+// number of consecutive failed scrapes, scrapes fail without requesting the target, except
+// for a single probe every probe interval. It's disabled if the threshold is 0.
+type CircuitBreakerConfig struct {
+	FailureThreshold int      `json:"failureThreshold,omitempty"`
+	ProbeInterval    Duration `json:"probeInterval,omitempty"`
+}
+
+// A TargetGroup is a list of targets sharing the same labels, as used by prometheus
+// service discovery
+type TargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// Duration is a time.Duration that is read from strings like 30s or 5m
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// RequestMetric holds the info for jolokia what to export. Attributes is used instead of
+// Attribute to read several attributes of a mbean at once.
 type RequestMetric struct {
-	Type      string `json:"type"`
-	Attribute string `json:"attribute,omitempty"`
-	Mbean     string `json:"mbean"`
-	Path      string `json:"path,omitempty"`
+	Type       string         `json:"type"`
+	Attribute  string         `json:"attribute,omitempty"`
+	Attributes []string       `json:"-"`
+	Mbean      string         `json:"mbean"`
+	Path       string         `json:"path,omitempty"`
+	Config     *RequestConfig `json:"config,omitempty"`
+}
+
+// RequestConfig holds the processing parameters of a single request
+type RequestConfig struct {
+	// IgnoreErrors returns the errors of single attributes of a multi attribute read as
+	// their values instead of failing the whole request
+	IgnoreErrors bool `json:"ignoreErrors,omitempty"`
+}
+
+// requestMetricJSON is the json form of a RequestMetric, whose attribute is a string or a
+// list of strings
+type requestMetricJSON struct {
+	Type      string          `json:"type"`
+	Attribute json.RawMessage `json:"attribute,omitempty"`
+	Mbean     string          `json:"mbean"`
+	Path      string          `json:"path,omitempty"`
+	Config    *RequestConfig  `json:"config,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (m RequestMetric) MarshalJSON() ([]byte, error) {
+	var attribute interface{}
+	if len(m.Attributes) > 0 {
+		attribute = m.Attributes
+	} else if m.Attribute != "" {
+		attribute = m.Attribute
+	}
+
+	raw := requestMetricJSON{Type: m.Type, Mbean: m.Mbean, Path: m.Path, Config: m.Config}
+	if attribute != nil {
+		var err error
+		if raw.Attribute, err = json.Marshal(attribute); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(raw)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (m *RequestMetric) UnmarshalJSON(b []byte) error {
+	var raw requestMetricJSON
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	*m = RequestMetric{Type: raw.Type, Mbean: raw.Mbean, Path: raw.Path, Config: raw.Config}
+	if len(raw.Attribute) > 0 && raw.Attribute[0] == '[' {
+		return json.Unmarshal(raw.Attribute, &m.Attributes)
+	} else if len(raw.Attribute) > 0 {
+		return json.Unmarshal(raw.Attribute, &m.Attribute)
+	}
+
+	return nil
 }
 
 func (m RequestMetric) String() string {
-	return sanitize(fmt.Sprintf("%s:%s:%s", m.Mbean, m.Attribute, m.Path))
+	attribute := m.Attribute
+	if len(m.Attributes) > 0 {
+		attribute = strings.Join(m.Attributes, ",")
+	}
+
+	return sanitize(fmt.Sprintf("%s:%s:%s", m.Mbean, attribute, m.Path))
 }
 
 // Request is a jolokia request holding a slice of RequestMetrics
@@ -0,0 +1,496 @@
+package jolokia
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	metricNameRegExp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRegExp  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// A ValidationError describes an invalid setting of the config. The path refers to the
+// setting, e.g. targets[1].url, the line to its position in a YAML config file.
+type ValidationError struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Path, e.Message)
+	}
+
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidationErrors holds all errors found by Config.Validate
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// validator collects the errors of a config
+type validator struct {
+	config *Config
+	errors ValidationErrors
+}
+
+func (v *validator) errorf(path, format string, args ...interface{}) {
+	v.errors = append(v.errors, ValidationError{
+		Path:    path,
+		Line:    v.config.line(path),
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Validate checks the config for settings that would fail or produce broken metrics at
+// runtime, e.g. invalid metric names, malformed mbean names, duplicate targets or
+// references to unknown modules. All errors are returned as ValidationErrors.
+func (c *Config) Validate() error {
+	v := &validator{config: c}
+
+	switch c.CollisionStrategy {
+	case "", CollisionFirst, CollisionLast, CollisionSuffix:
+	default:
+		v.errorf("collisionStrategy", "unknown collision strategy %q, expected %s, %s or %s", c.CollisionStrategy, CollisionFirst, CollisionLast, CollisionSuffix)
+	}
+
+	if c.MaxResponseSize < 0 {
+		v.errorf("maxResponseSize", "maximum response size must not be negative")
+	}
+
+	if c.MaxSeries < 0 {
+		v.errorf("maxSeries", "maximum series must not be negative")
+	}
+
+	if c.ScrapeTimeout < 0 {
+		v.errorf("scrapeTimeout", "scrape timeout must not be negative")
+	}
+
+	if c.Retry.MaxRetries < 0 {
+		v.errorf("retry.maxRetries", "maximum retries must not be negative")
+	}
+	if c.Retry.MinBackoff < 0 {
+		v.errorf("retry.minBackoff", "backoff must not be negative")
+	}
+	if c.Retry.MaxBackoff < 0 {
+		v.errorf("retry.maxBackoff", "backoff must not be negative")
+	} else if c.Retry.MaxBackoff > 0 && c.Retry.MaxBackoff < c.Retry.MinBackoff {
+		v.errorf("retry.maxBackoff", "maximum backoff must not be less than the minimum backoff")
+	}
+
+	if c.CircuitBreaker.FailureThreshold < 0 {
+		v.errorf("circuitBreaker.failureThreshold", "failure threshold must not be negative")
+	}
+	if c.CircuitBreaker.ProbeInterval < 0 {
+		v.errorf("circuitBreaker.probeInterval", "probe interval must not be negative")
+	}
+
+	v.metrics("metrics", c.Metrics)
+
+	modules := make([]string, 0, len(c.Modules))
+	for name := range c.Modules {
+		modules = append(modules, name)
+	}
+	sort.Strings(modules)
+
+	for _, name := range modules {
+		v.metrics(fmt.Sprintf("modules.%s.metrics", name), c.Modules[name].Metrics)
+	}
+
+	names := make(map[string]string, len(c.Targets))
+	for i, target := range c.Targets {
+		path := fmt.Sprintf("targets[%d]", i)
+
+		v.url(path+".url", target.URL, true)
+		v.module(path+".module", target.Module)
+		v.targetLabels(path+".labels", target.Labels)
+
+		name := targetName(target)
+		if other, ok := names[name]; ok {
+			v.errorf(path, "duplicate target %q, already defined by %s", name, other)
+		}
+		names[name] = path
+	}
+
+	for i, sd := range c.FileSDConfigs {
+		path := fmt.Sprintf("fileSdConfigs[%d]", i)
+
+		if len(sd.Files) == 0 {
+			v.errorf(path+".files", "at least one file is required")
+		}
+		v.module(path+".targetDefaults.module", sd.TargetDefaults.Module)
+		v.targetLabels(path+".targetDefaults.labels", sd.TargetDefaults.Labels)
+	}
+
+	for i, sd := range c.HTTPSDConfigs {
+		path := fmt.Sprintf("httpSdConfigs[%d]", i)
+
+		v.url(path+".url", sd.URL, true)
+		v.module(path+".targetDefaults.module", sd.TargetDefaults.Module)
+		v.targetLabels(path+".targetDefaults.labels", sd.TargetDefaults.Labels)
+	}
+
+	for i, rw := range c.RemoteWrite {
+		v.url(fmt.Sprintf("remoteWrite[%d].url", i), rw.URL, true)
+	}
+
+	for i, otlp := range c.OTLP {
+		v.url(fmt.Sprintf("otlp[%d].url", i), otlp.URL, true)
+	}
+
+	for i, sink := range c.Sinks {
+		path := fmt.Sprintf("sinks[%d]", i)
+
+		if sink.Type != SinkTypeGraphite && sink.Type != SinkTypeInflux {
+			v.errorf(path+".type", "unknown sink type %q, expected %s or %s", sink.Type, SinkTypeGraphite, SinkTypeInflux)
+		}
+		if sink.Address == "" {
+			v.errorf(path+".address", "address is required")
+		}
+		if sink.Protocol != "" && sink.Protocol != "tcp" && sink.Protocol != "udp" {
+			v.errorf(path+".protocol", "unknown protocol %q, expected tcp or udp", sink.Protocol)
+		}
+	}
+
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+
+	return nil
+}
+
+func (v *validator) metrics(path string, metrics []MetricMapping) {
+	targets := make(map[string]string, len(metrics))
+	sources := make(map[MetricSource]string, len(metrics))
+
+	for i, m := range metrics {
+		mappingPath := fmt.Sprintf("%s[%d]", path, i)
+
+		if m.Target == "" {
+			v.errorf(mappingPath+".target", "target is required")
+		} else if isTemplate(m.Target) {
+			v.nameTemplate(mappingPath+".target", m.Target, m)
+		} else if !metricNameRegExp.MatchString(m.Target) {
+			v.errorf(mappingPath+".target", "invalid metric name %q", m.Target)
+		} else if isMbeanPattern(m.Source.Mbean) || m.hasTemplates() {
+			// values of mbean patterns are named by mbean and attribute and values with
+			// label templates are told apart by their labels, so they may share a target.
+			// Their series aren't known before scraping, colliding ones are resolved by
+			// the collision strategy. Target templates aren't checked for the same reason.
+		} else if other, ok := targets[m.Target]; ok {
+			v.errorf(mappingPath+".target", "duplicate target %q, already used by %s", m.Target, other)
+		} else {
+			targets[m.Target] = mappingPath
+		}
+
+		if err := validateMbean(m.Source.Mbean); err != nil {
+			v.errorf(mappingPath+".source.mbean", "%v", err)
+		} else if other, ok := sources[m.Source]; ok {
+			v.errorf(mappingPath+".source", "duplicate source, already mapped by %s", other)
+		} else {
+			sources[m.Source] = mappingPath
+		}
+
+		if m.Source.Path != "" {
+			for _, segment := range strings.Split(m.Source.Path, "/") {
+				if segment == "" {
+					v.errorf(mappingPath+".source.path", "invalid path %q, path segments must not be empty", m.Source.Path)
+					break
+				}
+			}
+		}
+
+		if _, err := m.valueType(); err != nil {
+			v.errorf(mappingPath+".type", "unknown type %q, expected %s or %s", m.Type, MetricTypeGauge, MetricTypeCounter)
+		}
+
+		if m.Interval < 0 {
+			v.errorf(mappingPath+".interval", "interval must not be negative")
+		}
+
+		if m.MaxSeries < 0 {
+			v.errorf(mappingPath+".maxSeries", "maximum series must not be negative")
+		}
+
+		v.keyPatterns(mappingPath+".include", m.Include)
+		v.keyPatterns(mappingPath+".exclude", m.Exclude)
+
+		v.labels(mappingPath+".labels", m.Labels)
+		for _, name := range sortedKeys(m.Labels) {
+			if isTemplate(m.Labels[name]) {
+				v.nameTemplate(mappingPath+".labels."+name, m.Labels[name], m)
+			}
+		}
+	}
+}
+
+// nameTemplate checks a template of a mapping, its captures have to exist in a regular
+// expression include pattern of the mapping
+func (v *validator) nameTemplate(path, template string, m MetricMapping) {
+	t, err := parseTemplate(template)
+	if err != nil {
+		v.errorf(path, "invalid template %q: %v", template, err)
+		return
+	}
+
+	if strings.HasSuffix(path, ".target") && !t.validName() {
+		v.errorf(path, "invalid metric name template %q", template)
+	}
+
+	if capture := t.maxCapture(); capture > 0 {
+		filter, err := newKeyFilter(m)
+		if err == nil && (filter == nil || filter.maxCapture() < capture) {
+			v.errorf(path, "template %q refers to capture %d, but no include pattern has as many captures", template, capture)
+		}
+	}
+}
+
+func (v *validator) keyPatterns(path string, patterns []string) {
+	for i, pattern := range patterns {
+		if _, err := compileKeyPattern(pattern); err != nil {
+			v.errorf(fmt.Sprintf("%s[%d]", path, i), "invalid pattern %q: %v", pattern, err)
+		}
+	}
+}
+
+func (v *validator) module(path, module string) {
+	if module == "" {
+		return
+	}
+
+	if _, ok := v.config.Modules[module]; !ok {
+		v.errorf(path, "unknown module %q", module)
+	}
+}
+
+func (v *validator) labels(path string, labels map[string]string) {
+	for _, name := range sortedKeys(labels) {
+		if !labelNameRegExp.MatchString(name) || strings.HasPrefix(name, "__") {
+			v.errorf(path+"."+name, "invalid label name %q", name)
+		} else if name == targetLabel {
+			v.errorf(path+"."+name, "label %q is reserved for the target name", name)
+		}
+	}
+}
+
+// targetLabels checks the labels of targets, which are added to the sample age and
+// instrumentation series and so must not use the names of their source labels
+func (v *validator) targetLabels(path string, labels map[string]string) {
+	v.labels(path, labels)
+
+	for _, name := range sortedKeys(labels) {
+		if sourceLabels[name] {
+			v.errorf(path+"."+name, "label %q is reserved for the mapping source", name)
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (v *validator) url(path, rawURL string, required bool) {
+	if rawURL == "" {
+		if required {
+			v.errorf(path, "url is required")
+		}
+		return
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		v.errorf(path, "invalid url: %v", err)
+		return
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.errorf(path, "invalid url %q, expected an absolute http or https url", rawURL)
+	}
+}
+
+// validateMbean checks that a mbean name is an ObjectName of the form domain:key=value,...
+// Patterns like java.lang:type=GarbageCollector,name=* or java.lang:type=Memory,* are valid.
+func validateMbean(mbean string) error {
+	if mbean == "" {
+		return fmt.Errorf("mbean is required")
+	}
+
+	parts := strings.SplitN(mbean, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("invalid mbean %q, expected domain:key=value,...", mbean)
+	}
+
+	if parts[1] == "" {
+		return fmt.Errorf("invalid mbean %q, at least one key property is required", mbean)
+	}
+
+	keys := make(map[string]bool)
+	for _, property := range splitKeyProperties(parts[1]) {
+		if property == "*" {
+			continue
+		}
+
+		kv := strings.SplitN(property, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return fmt.Errorf("invalid key property %q of mbean %q, expected key=value", property, mbean)
+		}
+
+		if strings.HasPrefix(kv[1], `"`) && !validQuotedValue(kv[1]) {
+			return fmt.Errorf("invalid key property %q of mbean %q, quoted value isn't terminated", property, mbean)
+		}
+
+		if keys[kv[0]] {
+			return fmt.Errorf("duplicate key property %q of mbean %q", kv[0], mbean)
+		}
+		keys[kv[0]] = true
+	}
+
+	return nil
+}
+
+// validQuotedValue tells whether a quoted key property value ends with its first unescaped
+// quote after the opening one
+func validQuotedValue(value string) bool {
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '"':
+			return i == len(value)-1
+		}
+	}
+
+	return false
+}
+
+// line returns the line of the setting with the given path in the config file, or of its
+// closest parent setting. It returns 0 if the line is unknown, e.g. for JSON files.
+func (c *Config) line(path string) int {
+	for path != "" {
+		if line, ok := c.lines[path]; ok {
+			return line
+		}
+
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+
+	return 0
+}
+
+type yamlFrame struct {
+	col   int
+	path  string
+	list  bool
+	index int
+}
+
+// yamlLines returns the line numbers of the settings of a YAML document by their path,
+// e.g. targets[1].url. Only block style is indexed, flow style collections are found by
+// the line of their key.
+func yamlLines(b []byte) map[string]int {
+	lines := make(map[string]int)
+	frames := []yamlFrame{{}}
+	lastPath := ""
+
+	for n, line := range strings.Split(string(b), "\n") {
+		content := strings.TrimLeft(line, " ")
+		if content == "" || strings.HasPrefix(content, "#") || strings.HasPrefix(content, "---") {
+			continue
+		}
+
+		col := len(line) - len(content)
+		for len(frames) > 1 && frames[len(frames)-1].col > col {
+			frames = frames[:len(frames)-1]
+		}
+
+		for {
+			top := &frames[len(frames)-1]
+
+			if content == "-" || strings.HasPrefix(content, "- ") {
+				if !top.list || top.col != col {
+					frames = append(frames, yamlFrame{col: col, path: lastPath, list: true, index: -1})
+					top = &frames[len(frames)-1]
+				}
+
+				top.index++
+				lastPath = fmt.Sprintf("%s[%d]", top.path, top.index)
+				lines[lastPath] = n + 1
+
+				rest := strings.TrimLeft(content[1:], " ")
+				col += len(content) - len(rest)
+				content = rest
+
+				if _, ok := yamlKey(content); !ok {
+					break
+				}
+
+				frames = append(frames, yamlFrame{col: col, path: lastPath})
+				continue
+			}
+
+			if top.list && top.col == col && len(frames) > 1 {
+				frames = frames[:len(frames)-1]
+				top = &frames[len(frames)-1]
+			}
+
+			key, ok := yamlKey(content)
+			if !ok {
+				break
+			}
+
+			if top.list || top.col != col {
+				frames = append(frames, yamlFrame{col: col, path: lastPath})
+				top = &frames[len(frames)-1]
+			}
+
+			lastPath = key
+			if top.path != "" {
+				lastPath = top.path + "." + key
+			}
+			lines[lastPath] = n + 1
+			break
+		}
+	}
+
+	return lines
+}
+
+// yamlKey returns the key of a line like key: value
+func yamlKey(content string) (string, bool) {
+	if strings.HasPrefix(content, "{") || strings.HasPrefix(content, "[") {
+		return "", false
+	}
+
+	i := strings.Index(content, ": ")
+	if i < 0 && strings.HasSuffix(content, ":") {
+		i = len(content) - 1
+	}
+	if i <= 0 {
+		return "", false
+	}
+
+	return strings.Trim(content[:i], `"'`), true
+}
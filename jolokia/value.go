@@ -1,104 +1,275 @@
 package jolokia
 
 import (
-	"math"
-	"reflect"
 	"encoding/json"
-	"errors"
-	"strings"
+	"fmt"
+	"io"
 	"regexp"
+	"sort"
+	"strings"
+
 	"github.com/iancoleman/strcase"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var (
-	floatType = reflect.TypeOf(float64(0))
-
-	errNotAFloat = errors.New("value is not a float")
-
-	keyRegExp = regexp.MustCompile("[^a-zA-Z0-9_]")
+	keyRegExp        = regexp.MustCompile("[^a-zA-Z0-9_]")
 	underscoreRegExp = regexp.MustCompile("[_]{2,}")
 )
 
-// toFloat converts a given interface to a float64 value.
-// Code from https://stackoverflow.com/questions/20767724/converting-unknown-interface-to-float64-in-golang
-// working example at https://play.golang.org/p/v-QrbeOWtz
-func toFloat(unk interface{}) (float64, error) {
-	switch i := unk.(type) {
-	case float64:
-		return i, nil
-	case float32:
-		return float64(i), nil
-	case int64:
-		return float64(i), nil
-	case int32:
-		return float64(i), nil
-	case int:
-		return float64(i), nil
-	case uint64:
-		return float64(i), nil
-	case uint32:
-		return float64(i), nil
-	case uint:
-		return float64(i), nil
-	case string:
-		return math.NaN(), errNotAFloat
-	default:
-		v := reflect.ValueOf(unk)
-		v = reflect.Indirect(v)
-		if v.Type().ConvertibleTo(floatType) {
-			fv := v.Convert(floatType)
-			return fv.Float(), nil
-		} else {
-			return math.NaN(), errNotAFloat
+// A flatValue is a single named value of a flattened response value, fqName and desc
+// are the name and descriptor of its sample
+type flatValue struct {
+	name   string
+	fqName string
+	desc   *prometheus.Desc
+	mbean  string
+	value  float64
+}
+
+// A keyedValue is a numeric value found in a response value, keys is the path of object
+// keys leading to it
+type keyedValue struct {
+	keys  []string
+	value float64
+}
+
+// ignoredErrorPrefix starts the values jolokia returns for attributes that couldn't be
+// read, if errors are ignored
+const ignoredErrorPrefix = "ERROR: "
+
+// A keyedError is the error of an attribute returned as its value, keys is the path of
+// object keys leading to it
+type keyedError struct {
+	keys    []string
+	message string
+}
+
+// A responseEntry is the response to a single request of a bulk request, its value is
+// decoded to the numeric values it contains
+type responseEntry struct {
+	request   RequestMetric
+	values    []keyedValue
+	valueErr  error
+	errors    []keyedError
+	status    uint
+	error     string
+	errorType string
+
+	// nonNumeric and nulls count the values of the value that were dropped
+	nonNumeric int
+	nulls      int
+}
+
+// decodeResponse reads a jolokia bulk response in a single pass. The values are decoded
+// while reading, without holding the raw response or unmarshalling any part of it twice.
+func decodeResponse(r io.Reader) ([]responseEntry, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	if err := expectDelim(dec, '['); err != nil {
+		return nil, err
+	}
+
+	entries := make([]responseEntry, 0)
+	for dec.More() {
+		entry, err := decodeEntry(dec)
+		if err != nil {
+			return nil, err
 		}
+
+		entries = append(entries, entry)
 	}
+
+	return entries, expectDelim(dec, ']')
 }
 
-func getValues(target string, msg json.RawMessage) (map[string]float64, error) {
-	result := make(map[string]float64, 0)
+func decodeEntry(dec *json.Decoder) (responseEntry, error) {
+	entry := responseEntry{}
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return entry, err
+	}
+
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return entry, err
+		}
+
+		switch key {
+		case "request":
+			err = dec.Decode(&entry.request)
+		case "value":
+			v := valueDecoder{dec: dec}
+			entry.values, err = v.decode(nil)
+			entry.valueErr = v.err
+			entry.errors = v.errors
+			entry.nonNumeric, entry.nulls = v.nonNumeric, v.nulls
+		case "status":
+			err = dec.Decode(&entry.status)
+		case "error":
+			err = dec.Decode(&entry.error)
+		case "error_type":
+			err = dec.Decode(&entry.errorType)
+		default:
+			err = skipValue(dec)
+		}
 
-	var value NestedValue
-	if err := json.Unmarshal(msg, &value); err == nil {
-		for key, val := range value {
-			nestedResult, err := getValues(sanitize(strings.Join([]string{target, key}, "_")), val)
+		if err != nil {
+			return entry, err
+		}
+	}
+
+	return entry, expectDelim(dec, '}')
+}
+
+// valueDecoder decodes the numeric values of a response value. Keys of objects are
+// visited in sorted order, so if different keys flatten to the same name the values are
+// always returned in the same order. Strings, booleans, nulls and arrays are skipped,
+// except for strings holding ignored errors, which are collected.
+type valueDecoder struct {
+	dec *json.Decoder
+	// err is the first number that couldn't be converted to a float, the value is
+	// still read completely so the rest of the response can be decoded
+	err    error
+	errors []keyedError
+
+	nonNumeric int
+	nulls      int
+}
+
+// objectMember holds the values of a member of an object until the members are sorted
+type objectMember struct {
+	key    string
+	values []keyedValue
+}
+
+func (v *valueDecoder) decode(keys []string) ([]keyedValue, error) {
+	token, err := v.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '[' {
+			v.nonNumeric++
+			return nil, skipRest(v.dec)
+		}
+
+		members := make([]objectMember, 0)
+		for v.dec.More() {
+			key, err := v.dec.Token()
 			if err != nil {
 				return nil, err
 			}
 
-			result = mergeMaps(result, nestedResult)
+			// the keys are copied, as the slice is shared by all members
+			memberKeys := append(keys[:len(keys):len(keys)], key.(string))
+			values, err := v.decode(memberKeys)
+			if err != nil {
+				return nil, err
+			}
+
+			members = append(members, objectMember{key: key.(string), values: values})
+		}
+
+		if _, err := v.dec.Token(); err != nil {
+			return nil, err
+		}
+
+		return sortMembers(members), nil
+	case json.Number:
+		f, err := t.Float64()
+		if err != nil {
+			if v.err == nil {
+				v.err = err
+			}
+			return nil, nil
+		}
+
+		return []keyedValue{{keys: keys, value: f}}, nil
+	case string:
+		if strings.HasPrefix(t, ignoredErrorPrefix) {
+			v.errors = append(v.errors, keyedError{keys: keys, message: strings.TrimPrefix(t, ignoredErrorPrefix)})
+		} else {
+			v.nonNumeric++
 		}
+
+		return nil, nil
+	case nil:
+		v.nulls++
+		return nil, nil
+	default:
+		v.nonNumeric++
+		return nil, nil
 	}
+}
 
-	val, err := getFloatValue(msg)
-	if err != nil {
-		// if the value is not parseable as float and is not a nested value an empty map is returned
-		if err == errNotAFloat {
-			return result, nil
+// sortMembers returns the values of the members sorted by key. Of duplicate keys only the
+// last member is kept, like unmarshalling into a map would do.
+func sortMembers(members []objectMember) []keyedValue {
+	sort.SliceStable(members, func(i, j int) bool {
+		return members[i].key < members[j].key
+	})
+
+	values := make([]keyedValue, 0)
+	for i, member := range members {
+		if i+1 < len(members) && members[i+1].key == member.key {
+			continue
 		}
 
-		return nil, err
+		values = append(values, member.values...)
 	}
 
-	result[target] = val
+	return values
+}
 
-	return result, nil
+// skipValue reads the next value without decoding it
+func skipValue(dec *json.Decoder) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if delim, ok := token.(json.Delim); ok && (delim == '[' || delim == '{') {
+		return skipRest(dec)
+	}
+
+	return nil
 }
 
-func getFloatValue(msg json.RawMessage) (float64, error) {
-	var value SimpleValue
-	if err := json.Unmarshal(msg, &value); err != nil {
-		return 0, err
+// skipRest reads the rest of an array or object whose opening delimiter was already read
+func skipRest(dec *json.Decoder) error {
+	for depth := 1; depth > 0; {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch token {
+		case json.Delim('['), json.Delim('{'):
+			depth++
+		case json.Delim(']'), json.Delim('}'):
+			depth--
+		}
 	}
 
-	return toFloat(value)
+	return nil
 }
 
-func mergeMaps(v1, v2 map[string]float64) map[string]float64 {
-	for k, v := range v2 {
-		v1[k] = v
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if token != delim {
+		return fmt.Errorf("expected %v, got %v", delim, token)
 	}
 
-	return v1
+	return nil
 }
 
 func sanitize(key string) string {
@@ -0,0 +1,132 @@
+package jolokia
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The former value extraction, which unmarshalled the response into json.RawMessage values
+// and every nested value twice. It's kept to compare results and benchmarks with the
+// streaming decoder.
+
+var (
+	legacyFloatType    = reflect.TypeOf(float64(0))
+	errLegacyNotAFloat = errors.New("value is not a float")
+)
+
+// legacyFlatten flattens a response the way the client did before the streaming decoder
+func legacyFlatten(body []byte, mappings map[string]MetricMapping) ([]flatValue, error) {
+	var response Response
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	result := make([]flatValue, 0)
+	for _, metric := range response {
+		mapping, ok := mappings[metric.Request.String()]
+		if !ok || metric.Status != 200 {
+			continue
+		}
+
+		values, err := legacyMbeanValues(mapping, metric.Value)
+		if err != nil {
+			continue
+		}
+		result = append(result, values...)
+	}
+
+	return result, nil
+}
+
+func legacyMbeanValues(mapping MetricMapping, value json.RawMessage) ([]flatValue, error) {
+	var nested NestedValue
+	if !isMbeanPattern(mapping.Source.Mbean) || json.Unmarshal(value, &nested) != nil {
+		values, err := legacyGetValues(mapping.Target, value)
+		for i := range values {
+			values[i].mbean = mapping.Source.Mbean
+		}
+
+		return values, err
+	}
+
+	mbeans := make([]string, 0, len(nested))
+	for mbean := range nested {
+		mbeans = append(mbeans, mbean)
+	}
+	sort.Strings(mbeans)
+
+	result := make([]flatValue, 0)
+	for _, mbean := range mbeans {
+		values, err := legacyGetValues(sanitize(strings.Join([]string{mapping.Target, mbean}, "_")), nested[mbean])
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range values {
+			values[i].mbean = mbean
+		}
+		result = append(result, values...)
+	}
+
+	return result, nil
+}
+
+func legacyGetValues(target string, msg json.RawMessage) ([]flatValue, error) {
+	result := make([]flatValue, 0)
+
+	var value NestedValue
+	if err := json.Unmarshal(msg, &value); err == nil {
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			nestedResult, err := legacyGetValues(sanitize(strings.Join([]string{target, key}, "_")), value[key])
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, nestedResult...)
+		}
+	}
+
+	var value2 SimpleValue
+	if err := json.Unmarshal(msg, &value2); err != nil {
+		return nil, err
+	}
+
+	val, err := legacyToFloat(value2)
+	if err != nil {
+		if err == errLegacyNotAFloat {
+			return result, nil
+		}
+
+		return nil, err
+	}
+
+	result = append(result, flatValue{name: target, value: val})
+
+	return result, nil
+}
+
+func legacyToFloat(unk interface{}) (float64, error) {
+	switch i := unk.(type) {
+	case float64:
+		return i, nil
+	case string:
+		return math.NaN(), errLegacyNotAFloat
+	default:
+		v := reflect.Indirect(reflect.ValueOf(unk))
+		if v.Type().ConvertibleTo(legacyFloatType) {
+			return v.Convert(legacyFloatType).Float(), nil
+		}
+
+		return math.NaN(), errLegacyNotAFloat
+	}
+}
@@ -0,0 +1,230 @@
+package jolokia
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeResponse(t *testing.T) {
+	entries, err := decodeResponse(strings.NewReader(`[
+		{
+			"value": {"b": 2, "a": {"y": 1, "x": "text"}, "c": [1, 2, {"d": 3}], "e": true, "f": null, "b": 4},
+			"status": 200,
+			"request": {"mbean": "java.lang:type=Test", "type": "read"},
+			"timestamp": 1520095218
+		},
+		{
+			"request": {"mbean": "java.lang:type=Missing", "type": "read"},
+			"error": "not found",
+			"error_type": "javax.management.InstanceNotFoundException",
+			"status": 404
+		},
+		{
+			"request": {"mbean": "java.lang:type=Huge", "type": "read"},
+			"value": {"a": 1e400, "b": 1},
+			"status": 200
+		}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+
+	expected := []keyedValue{
+		{keys: []string{"a", "y"}, value: 1},
+		{keys: []string{"b"}, value: 4},
+	}
+	if !reflect.DeepEqual(entries[0].values, expected) {
+		t.Errorf("Expected values %v, got %v", expected, entries[0].values)
+	}
+	if entries[0].request.Mbean != "java.lang:type=Test" || entries[0].status != 200 {
+		t.Errorf("Unexpected entry %+v", entries[0])
+	}
+
+	if entries[1].status != 404 || entries[1].errorType != "javax.management.InstanceNotFoundException" || entries[1].error != "not found" {
+		t.Errorf("Unexpected error entry %+v", entries[1])
+	}
+
+	if entries[2].valueErr == nil {
+		t.Error("Expected an error for a number out of the float range")
+	}
+}
+
+func TestDecodeResponse_Invalid(t *testing.T) {
+	for _, body := range []string{`{"status": 400}`, `[{"value": 1}`, `[{"value": }]`} {
+		if _, err := decodeResponse(strings.NewReader(body)); err == nil {
+			t.Errorf("Expected an error for response %s", body)
+		}
+	}
+}
+
+func TestFlatValues_MatchLegacy(t *testing.T) {
+	fixture, err := ioutil.ReadFile(path.Join("fixtures", "response.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wildcard, wildcardMappings := wildcardResponse(20, 5)
+
+	fixtureMappings := make(map[string]MetricMapping)
+	for _, m := range expectedConfig.Metrics {
+		request := RequestMetric{Type: requestTypeRead, Mbean: m.Source.Mbean, Attribute: m.Source.Attribute, Path: m.Source.Path}
+		fixtureMappings[request.String()] = m
+	}
+
+	tests := []struct {
+		body     []byte
+		mappings map[string]MetricMapping
+	}{
+		{fixture, fixtureMappings},
+		{wildcard, wildcardMappings},
+	}
+
+	for i, test := range tests {
+		expected, err := legacyFlatten(test.body, test.mappings)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := streamingFlatten(test.body, test.mappings)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected response %d to flatten like before to %v, got %v", i, expected, actual)
+		}
+	}
+}
+
+func TestClient_ScrapeMaxResponseSize(t *testing.T) {
+	response, err := ioutil.ReadFile(path.Join("fixtures", "response.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(response)
+	}))
+	defer agent.Close()
+
+	for _, test := range []struct {
+		max   int64
+		error bool
+	}{
+		{0, false},
+		{int64(len(response)), false},
+		{int64(len(response)) / 2, true},
+	} {
+		config := *expectedConfig
+		config.MaxResponseSize = test.max
+
+		client, err := NewClient(ClientOptions{Config: &config, Namespace: Namespace, Target: TargetConfig{URL: agent.URL}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.Scrape(context.Background())
+		if test.error && (err == nil || !strings.Contains(err.Error(), "exceeds the maximum size")) {
+			t.Errorf("Expected max size %d to fail the scrape, got %v", test.max, err)
+		} else if !test.error && err != nil {
+			t.Errorf("Expected max size %d not to fail the scrape, got %v", test.max, err)
+		}
+	}
+}
+
+func BenchmarkFlatten(b *testing.B) {
+	body, mappings := wildcardResponse(500, 20)
+
+	b.Run("legacy", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+
+		for i := 0; i < b.N; i++ {
+			if _, err := legacyFlatten(body, mappings); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("streaming", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+
+		for i := 0; i < b.N; i++ {
+			if _, err := streamingFlatten(body, mappings); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// streamingFlatten flattens a response with the streaming decoder, like legacyFlatten
+func streamingFlatten(body []byte, mappings map[string]MetricMapping) ([]flatValue, error) {
+	entries, err := decodeResponse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	names := newNameCache("", nil)
+
+	result := make([]flatValue, 0)
+	for _, entry := range entries {
+		mapping, ok := mappings[entry.request.String()]
+		if !ok || entry.status != 200 || entry.valueErr != nil {
+			continue
+		}
+
+		for _, v := range names.flatValues(mapping, entry.values) {
+			result = append(result, flatValue{name: v.name, mbean: v.mbean, value: v.value})
+		}
+	}
+
+	return result, nil
+}
+
+// wildcardResponse returns the response to a mbean pattern matching the given number of
+// mbeans with nested attributes, together with the mappings of the request
+func wildcardResponse(mbeans, attributes int) ([]byte, map[string]MetricMapping) {
+	mapping := MetricMapping{
+		Source: MetricSource{Mbean: "java.lang:name=*,type=Test"},
+		Target: "java_test",
+	}
+
+	value := make(map[string]interface{}, mbeans)
+	for i := 0; i < mbeans; i++ {
+		attrs := map[string]interface{}{
+			"Name":    fmt.Sprintf("test %d", i),
+			"Enabled": true,
+			"Usage":   map[string]interface{}{"used": i * 1024, "max": 1 << 30, "committed": i * 2048},
+			"Ids":     []int{1, 2, 3},
+		}
+		for j := 0; j < attributes; j++ {
+			attrs[fmt.Sprintf("Attribute%d", j)] = float64(i*j) / 3
+		}
+
+		value[fmt.Sprintf("java.lang:name=Test %d,type=Test", i)] = attrs
+	}
+
+	request := RequestMetric{Type: requestTypeRead, Mbean: mapping.Source.Mbean}
+	body, _ := json.Marshal([]map[string]interface{}{{
+		"request":   request,
+		"value":     value,
+		"timestamp": 1520095218,
+		"status":    200,
+	}})
+
+	return body, map[string]MetricMapping{request.String(): mapping}
+}